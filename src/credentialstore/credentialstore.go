@@ -0,0 +1,243 @@
+package credentialstore
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"musicserviceclients"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const STORE_VERSION = 1
+
+const (
+	KEY_ITERATIONS = 600000
+	KEY_SIZE       = 32
+	SALT_SIZE      = 16
+)
+
+var ErrWrongPassphrase = errors.New("wrong passphrase or corrupted credential store")
+
+// ErrCorrupted is returned for stores whose nonce or data is too short to have been written by
+// this package, which the cipher would otherwise panic on.
+var ErrCorrupted = errors.New("corrupted credential store")
+
+type entry struct {
+	Service   string    `json:"service"`
+	Account   string    `json:"account"`
+	Secret    string    `json:"secret"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// envelope is the on-disk format. Only the credentials are encrypted, the salt and nonce are
+// stored next to them in the clear.
+type envelope struct {
+	Version int    `json:"version"`
+	Salt    []byte `json:"salt"`
+	Nonce   []byte `json:"nonce"`
+	Data    []byte `json:"data"`
+}
+
+// Store caches service credentials in a file encrypted with AES-GCM under a key derived from a
+// passphrase. It is safe for concurrent use.
+type Store struct {
+	path    string
+	mu      sync.Mutex
+	salt    []byte
+	aead    cipher.AEAD
+	entries map[string]entry
+}
+
+// Open reads the store at path, creating an empty one when the file does not exist yet.
+func Open(path string, passphrase []byte) (*Store, error) {
+	if len(passphrase) == 0 {
+		return nil, errors.New("a passphrase is required to open the credential store")
+	}
+	store := &Store{path: path, entries: make(map[string]entry)}
+	content, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		store.salt = make([]byte, SALT_SIZE)
+		if _, err = rand.Read(store.salt); err != nil {
+			return nil, fmt.Errorf("failed to generate salt [err=%v]", err)
+		}
+		store.aead, err = newAead(passphrase, store.salt)
+		if err != nil {
+			return nil, err
+		}
+		return store, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read credential store [path=%s][err=%v]", path, err)
+	}
+	var stored envelope
+	err = json.Unmarshal(content, &stored)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse credential store [path=%s][err=%v]", path, err)
+	}
+	if stored.Version > STORE_VERSION {
+		return nil, fmt.Errorf("unsupported credential store version [path=%s][version=%d]", path, stored.Version)
+	}
+	store.salt = stored.Salt
+	store.aead, err = newAead(passphrase, store.salt)
+	if err != nil {
+		return nil, err
+	}
+	if len(stored.Nonce) != store.aead.NonceSize() || len(stored.Data) < store.aead.Overhead() {
+		return nil, fmt.Errorf("truncated credential store [path=%s][nonce=%d][data=%d][err=%w]", path, len(stored.Nonce), len(stored.Data), ErrCorrupted)
+	}
+	plaintext, err := store.aead.Open(nil, stored.Nonce, stored.Data, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt credential store [path=%s][err=%w]", path, ErrWrongPassphrase)
+	}
+	var entries []entry
+	err = json.Unmarshal(plaintext, &entries)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse credentials [path=%s][err=%v]", path, err)
+	}
+	for _, e := range entries {
+		store.entries[key(e.Service, e.Account)] = e
+	}
+	return store, nil
+}
+
+// ReadPassphrase reads the passphrase from keyFile when it is set and otherwise from the
+// environment variable env.
+func ReadPassphrase(keyFile, env string) ([]byte, error) {
+	if len(keyFile) > 0 {
+		content, err := ioutil.ReadFile(keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read key file [path=%s][err=%v]", keyFile, err)
+		}
+		return []byte(strings.TrimRight(string(content), "\r\n")), nil
+	}
+	return []byte(os.Getenv(env)), nil
+}
+
+// Credential returns the credential of account. An empty account matches the most recently
+// updated credential of the service.
+func (s *Store) Credential(service, account string) (musicserviceclients.Credential, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(account) > 0 {
+		e, ok := s.entries[key(service, account)]
+		return musicserviceclients.Credential{Account: e.Account, Secret: e.Secret}, ok
+	}
+	var latest *entry
+	for _, e := range s.entries {
+		if e.Service == service && (latest == nil || e.UpdatedAt.After(latest.UpdatedAt)) {
+			current := e
+			latest = &current
+		}
+	}
+	if latest == nil {
+		return musicserviceclients.Credential{}, false
+	}
+	return musicserviceclients.Credential{Account: latest.Account, Secret: latest.Secret}, true
+}
+
+// SaveCredential records the credential and writes the store right away, so a rotated refresh
+// token is never lost.
+func (s *Store) SaveCredential(service string, credential musicserviceclients.Credential) error {
+	if len(credential.Secret) == 0 {
+		return nil
+	}
+	s.mu.Lock()
+	s.entries[key(service, credential.Account)] = entry{
+		Service:   service,
+		Account:   credential.Account,
+		Secret:    credential.Secret,
+		UpdatedAt: time.Now().UTC()}
+	s.mu.Unlock()
+	return s.Save()
+}
+
+// DeleteCredential removes the credential of account, or every credential of the service when
+// account is empty, and returns the number of removed credentials.
+func (s *Store) DeleteCredential(service, account string) (int, error) {
+	s.mu.Lock()
+	removed := 0
+	for k, e := range s.entries {
+		if e.Service == service && (len(account) == 0 || e.Account == account) {
+			delete(s.entries, k)
+			removed++
+		}
+	}
+	s.mu.Unlock()
+	if removed == 0 {
+		return 0, nil
+	}
+	return removed, s.Save()
+}
+
+// Save encrypts the credentials with a fresh nonce and writes them to a temporary file first so
+// an interrupted run never truncates the store.
+func (s *Store) Save() error {
+	s.mu.Lock()
+	var entries []entry
+	for _, e := range s.entries {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return key(entries[i].Service, entries[i].Account) < key(entries[j].Service, entries[j].Account)
+	})
+	plaintext, err := json.Marshal(entries)
+	if err != nil {
+		s.mu.Unlock()
+		return fmt.Errorf("failed to encode credentials [err=%v]", err)
+	}
+	stored := envelope{Version: STORE_VERSION, Salt: s.salt, Nonce: make([]byte, s.aead.NonceSize())}
+	if _, err = rand.Read(stored.Nonce); err != nil {
+		s.mu.Unlock()
+		return fmt.Errorf("failed to generate nonce [err=%v]", err)
+	}
+	stored.Data = s.aead.Seal(nil, stored.Nonce, plaintext, nil)
+	s.mu.Unlock()
+	content, err := json.MarshalIndent(stored, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode credential store [err=%v]", err)
+	}
+	temporary, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path)+".tmp")
+	if err != nil {
+		return fmt.Errorf("failed to write credential store [path=%s][err=%v]", s.path, err)
+	}
+	_, err = temporary.Write(content)
+	closeErr := temporary.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(temporary.Name(), s.path)
+	}
+	if err != nil {
+		os.Remove(temporary.Name())
+		return fmt.Errorf("failed to write credential store [path=%s][err=%v]", s.path, err)
+	}
+	return nil
+}
+
+func newAead(passphrase, salt []byte) (cipher.AEAD, error) {
+	derived, err := pbkdf2.Key(sha256.New, string(passphrase), salt, KEY_ITERATIONS, KEY_SIZE)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive key [err=%v]", err)
+	}
+	block, err := aes.NewCipher(derived)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher [err=%v]", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+func key(service, account string) string {
+	return service + ":" + strings.ToLower(account)
+}
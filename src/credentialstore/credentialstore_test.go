@@ -0,0 +1,155 @@
+package credentialstore
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"musicserviceclients"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var testPassphrase = []byte("correct horse battery staple")
+
+func newTestStore(t *testing.T) (*Store, string) {
+	path := filepath.Join(t.TempDir(), "credentials.json")
+	store, err := Open(path, testPassphrase)
+	if err != nil {
+		t.Fatalf("Open() failed [err=%v]", err)
+	}
+	credentials := map[string]musicserviceclients.Credential{
+		"spotify": {Account: "alice", Secret: "spotify-refresh-token"},
+		"gpm":     {Account: "alice@example.com", Secret: "gpm-master-token"}}
+	for service, credential := range credentials {
+		if err := store.SaveCredential(service, credential); err != nil {
+			t.Fatalf("SaveCredential() failed [service=%s][err=%v]", service, err)
+		}
+	}
+	return store, path
+}
+
+func TestStoreRoundTrip(t *testing.T) {
+	_, path := newTestStore(t)
+	store, err := Open(path, testPassphrase)
+	if err != nil {
+		t.Fatalf("Open() failed [err=%v]", err)
+	}
+	tests := []struct {
+		service  string
+		account  string
+		expected musicserviceclients.Credential
+		found    bool
+	}{
+		{"spotify", "alice", musicserviceclients.Credential{Account: "alice", Secret: "spotify-refresh-token"}, true},
+		{"spotify", "ALICE", musicserviceclients.Credential{Account: "alice", Secret: "spotify-refresh-token"}, true},
+		{"spotify", "", musicserviceclients.Credential{Account: "alice", Secret: "spotify-refresh-token"}, true},
+		{"gpm", "alice@example.com", musicserviceclients.Credential{Account: "alice@example.com", Secret: "gpm-master-token"}, true},
+		{"spotify", "bob", musicserviceclients.Credential{}, false},
+		{"file", "", musicserviceclients.Credential{}, false},
+	}
+	for _, test := range tests {
+		credential, found := store.Credential(test.service, test.account)
+		if credential != test.expected || found != test.found {
+			t.Errorf("Credential(%s, %s) = %+v, %t, want %+v, %t", test.service, test.account, credential, found, test.expected, test.found)
+		}
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(content), "spotify-refresh-token") || strings.Contains(string(content), "gpm-master-token") {
+		t.Errorf("credential store holds a secret in the clear:\n%s", content)
+	}
+}
+
+func TestStoreWrongPassphrase(t *testing.T) {
+	_, path := newTestStore(t)
+	_, err := Open(path, []byte("wrong passphrase"))
+	if !errors.Is(err, ErrWrongPassphrase) {
+		t.Errorf("Open() with a wrong passphrase err = %v, want %v", err, ErrWrongPassphrase)
+	}
+}
+
+func TestStoreCorrupted(t *testing.T) {
+	_, path := newTestStore(t)
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stored envelope
+	if err := json.Unmarshal(content, &stored); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		corrupt func(stored envelope) envelope
+		content []byte
+	}{
+		{"truncated file", nil, content[:len(content)/2]},
+		{"empty file", nil, []byte{}},
+		{"short nonce", func(stored envelope) envelope { stored.Nonce = stored.Nonce[:4]; return stored }, nil},
+		{"missing nonce", func(stored envelope) envelope { stored.Nonce = nil; return stored }, nil},
+		{"short data", func(stored envelope) envelope { stored.Data = stored.Data[:8]; return stored }, nil},
+		{"missing data", func(stored envelope) envelope { stored.Data = nil; return stored }, nil},
+		{"flipped data", func(stored envelope) envelope {
+			stored.Data = append([]byte(nil), stored.Data...)
+			stored.Data[0] ^= 0xff
+			return stored
+		}, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			corrupted := test.content
+			if test.corrupt != nil {
+				corrupted, err = json.Marshal(test.corrupt(stored))
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			corruptedPath := filepath.Join(t.TempDir(), "credentials.json")
+			if err := ioutil.WriteFile(corruptedPath, corrupted, 0600); err != nil {
+				t.Fatal(err)
+			}
+			store, err := Open(corruptedPath, testPassphrase)
+			if err == nil || store != nil {
+				t.Errorf("Open() of a corrupted store = %v, %v, want an error", store, err)
+			}
+		})
+	}
+}
+
+func TestStoreDeleteCredential(t *testing.T) {
+	store, path := newTestStore(t)
+	if err := store.SaveCredential("spotify", musicserviceclients.Credential{Account: "bob", Secret: "bob-refresh-token"}); err != nil {
+		t.Fatalf("SaveCredential() failed [err=%v]", err)
+	}
+	removed, err := store.DeleteCredential("spotify", "alice")
+	if err != nil || removed != 1 {
+		t.Fatalf("DeleteCredential(spotify, alice) = %d, %v, want 1", removed, err)
+	}
+	reopened, err := Open(path, testPassphrase)
+	if err != nil {
+		t.Fatalf("Open() failed [err=%v]", err)
+	}
+	if _, found := reopened.Credential("spotify", "alice"); found {
+		t.Error("deleted credential of alice is still stored")
+	}
+	if _, found := reopened.Credential("spotify", "bob"); !found {
+		t.Error("credential of bob was deleted with alice's")
+	}
+	removed, err = reopened.DeleteCredential("spotify", "")
+	if err != nil || removed != 1 {
+		t.Fatalf("DeleteCredential(spotify) = %d, %v, want 1", removed, err)
+	}
+	reopened, err = Open(path, testPassphrase)
+	if err != nil {
+		t.Fatalf("Open() failed [err=%v]", err)
+	}
+	if _, found := reopened.Credential("spotify", ""); found {
+		t.Error("spotify credentials are still stored after deleting all of them")
+	}
+	if _, found := reopened.Credential("gpm", ""); !found {
+		t.Error("gpm credential was deleted with the spotify ones")
+	}
+}
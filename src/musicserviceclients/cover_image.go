@@ -0,0 +1,75 @@
+package musicserviceclients
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"net/http"
+)
+
+const IMAGE_FORMAT_JPEG = "jpeg"
+
+// Images that are too large are encoded again at each of these qualities until one fits, and
+// halved in size if none does, down to MIN_COVER_IMAGE_SIZE pixels.
+var coverImageQualities = []int{90, 75, 60, 45}
+
+const MIN_COVER_IMAGE_SIZE = 64
+
+// fetchCoverImage downloads a cover image through transport, retrying like any other request.
+func fetchCoverImage(transport *httpTransport, imageUrl string) ([]byte, error) {
+	content, err := transport.do(http.MethodGet, imageUrl, imageUrl, nil, http.Header{}, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download cover image [url=%s][err=%v]", imageUrl, err)
+	}
+	return []byte(content), nil
+}
+
+// jpegCoverImage returns content as a JPEG of at most maxBytes. JPEGs that already fit are
+// returned unchanged, PNGs, GIFs and larger JPEGs are encoded again.
+func jpegCoverImage(content []byte, maxBytes int) ([]byte, error) {
+	decoded, format, err := image.Decode(bytes.NewReader(content))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode cover image [bytes=%d][err=%v]", len(content), err)
+	}
+	if format == IMAGE_FORMAT_JPEG && len(content) <= maxBytes {
+		return content, nil
+	}
+	for {
+		for _, quality := range coverImageQualities {
+			var buffer bytes.Buffer
+			err = jpeg.Encode(&buffer, decoded, &jpeg.Options{Quality: quality})
+			if err != nil {
+				return nil, fmt.Errorf("failed to encode cover image [format=%s][err=%v]", format, err)
+			}
+			if buffer.Len() <= maxBytes {
+				return buffer.Bytes(), nil
+			}
+		}
+		bounds := decoded.Bounds()
+		if bounds.Dx()/2 < MIN_COVER_IMAGE_SIZE || bounds.Dy()/2 < MIN_COVER_IMAGE_SIZE {
+			return nil, fmt.Errorf("failed to fit cover image [format=%s][bytes=%d][max=%d]", format, len(content), maxBytes)
+		}
+		decoded = halveImage(decoded)
+	}
+}
+
+// halveImage scales picture to half its width and height, averaging each square of 4 pixels.
+func halveImage(picture image.Image) image.Image {
+	bounds := picture.Bounds()
+	halved := image.NewRGBA(image.Rect(0, 0, bounds.Dx()/2, bounds.Dy()/2))
+	for y := 0; y < bounds.Dy()/2; y++ {
+		for x := 0; x < bounds.Dx()/2; x++ {
+			var r, g, b, a uint32
+			for _, offset := range [][2]int{{0, 0}, {1, 0}, {0, 1}, {1, 1}} {
+				pr, pg, pb, pa := picture.At(bounds.Min.X+2*x+offset[0], bounds.Min.Y+2*y+offset[1]).RGBA()
+				r, g, b, a = r+pr, g+pg, b+pb, a+pa
+			}
+			halved.Set(x, y, color.RGBA64{uint16(r / 4), uint16(g / 4), uint16(b / 4), uint16(a / 4)})
+		}
+	}
+	return halved
+}
@@ -0,0 +1,75 @@
+package musicserviceclients
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func TestJpegCoverImage(t *testing.T) {
+	small := encodeTestImage(t, "jpeg", 64, 64)
+	tests := []struct {
+		name      string
+		content   []byte
+		maxBytes  int
+		unchanged bool
+		fails     bool
+	}{
+		{"small jpeg", small, MAX_SPOTIFY_COVER_IMAGE_BYTES, true, false},
+		{"png", encodeTestImage(t, "png", 64, 64), MAX_SPOTIFY_COVER_IMAGE_BYTES, false, false},
+		{"large jpeg", encodeTestImage(t, "jpeg", 640, 640), 64 * 1024, false, false},
+		{"too large", small, 100, false, true},
+		{"not an image", []byte("<html>not found</html>"), MAX_SPOTIFY_COVER_IMAGE_BYTES, false, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actual, err := jpegCoverImage(test.content, test.maxBytes)
+			if test.fails {
+				if err == nil {
+					t.Errorf("jpegCoverImage() returned %d bytes, want an error", len(actual))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("jpegCoverImage() failed [err=%v]", err)
+			}
+			if len(actual) > test.maxBytes {
+				t.Errorf("jpegCoverImage() returned %d bytes, want at most %d", len(actual), test.maxBytes)
+			}
+			if test.unchanged != bytes.Equal(actual, test.content) {
+				t.Errorf("jpegCoverImage() changed the image: %t, want %t", !bytes.Equal(actual, test.content), !test.unchanged)
+			}
+			_, format, err := image.DecodeConfig(bytes.NewReader(actual))
+			if err != nil || format != IMAGE_FORMAT_JPEG {
+				t.Errorf("jpegCoverImage() returned a %s image [err=%v], want jpeg", format, err)
+			}
+		})
+	}
+}
+
+// encodeTestImage draws a noisy image, which does not compress well, in format.
+func encodeTestImage(t *testing.T, format string, width, height int) []byte {
+	t.Helper()
+	picture := image.NewRGBA(image.Rect(0, 0, width, height))
+	seed := uint32(1)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			seed = seed*1664525 + 1013904223
+			picture.Set(x, y, color.RGBA{uint8(seed >> 24), uint8(seed >> 16), uint8(seed >> 8), 255})
+		}
+	}
+	var buffer bytes.Buffer
+	var err error
+	if format == "png" {
+		err = png.Encode(&buffer, picture)
+	} else {
+		err = jpeg.Encode(&buffer, picture, &jpeg.Options{Quality: 95})
+	}
+	if err != nil {
+		t.Fatalf("failed to encode test image [format=%s][err=%v]", format, err)
+	}
+	return buffer.Bytes()
+}
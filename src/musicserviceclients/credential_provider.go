@@ -0,0 +1,146 @@
+package musicserviceclients
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"sync"
+)
+
+const (
+	CREDENTIAL_SPOTIFY_TOKEN = "spotify-token"
+	CREDENTIAL_GPM_USERNAME  = "gpm-username"
+	CREDENTIAL_GPM_PASSWORD  = "gpm-password"
+)
+
+const CREDENTIAL_ENV_PREFIX = "PLAYLISTSYNCER_"
+
+var ErrCredentialNotFound = errors.New("credential not found")
+
+// CredentialProvider supplies the values a client asks for when it logs in. prompt is only
+// shown by providers that ask a user.
+type CredentialProvider interface {
+	Credential(key, prompt string) (string, error)
+}
+
+// StdinCredentials is shared by every client so that they read piped input from one buffer.
+var StdinCredentials = NewStdinProvider(os.Stdin)
+
+// StdinProvider prompts for each value and reads it from one line of input.
+type StdinProvider struct {
+	mu     sync.Mutex
+	reader *bufio.Reader
+}
+
+func NewStdinProvider(input io.Reader) *StdinProvider {
+	return &StdinProvider{reader: bufio.NewReader(input)}
+}
+
+func (p *StdinProvider) Credential(key, prompt string) (string, error) {
+	value, err := p.Prompt(prompt)
+	if err != nil {
+		return "", fmt.Errorf("failed to read credential [key=%s][err=%v]", key, err)
+	}
+	return value, nil
+}
+
+// Prompt shows prompt and reads one line, for anything else that has to ask the user.
+func (p *StdinProvider) Prompt(prompt string) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	log.Print(prompt)
+	line, err := p.reader.ReadString('\n')
+	if err == io.EOF && len(line) > 0 {
+		err = nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(line), nil
+}
+
+// EnvProvider reads PLAYLISTSYNCER_<KEY>, e.g. PLAYLISTSYNCER_GPM_PASSWORD.
+type EnvProvider struct{}
+
+func (p EnvProvider) Credential(key, prompt string) (string, error) {
+	value, ok := os.LookupEnv(CredentialEnv(key))
+	if !ok || len(value) == 0 {
+		return "", fmt.Errorf("failed to find credential [env=%s][err=%w]", CredentialEnv(key), ErrCredentialNotFound)
+	}
+	return value, nil
+}
+
+func CredentialEnv(key string) string {
+	return CREDENTIAL_ENV_PREFIX + strings.ToUpper(strings.Replace(key, "-", "_", -1))
+}
+
+// FlagProvider holds the values given on the command line. Empty values count as missing.
+type FlagProvider map[string]string
+
+func (p FlagProvider) Credential(key, prompt string) (string, error) {
+	value := p[key]
+	if len(value) == 0 {
+		return "", fmt.Errorf("failed to find credential [key=%s][err=%w]", key, ErrCredentialNotFound)
+	}
+	return value, nil
+}
+
+// FileProvider reads "key=value" lines from a file. Blank lines and lines starting with # are
+// ignored.
+type FileProvider struct {
+	path   string
+	values map[string]string
+}
+
+func NewFileProvider(path string) (*FileProvider, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read credentials file [path=%s][err=%v]", path, err)
+	}
+	provider := &FileProvider{path: path, values: make(map[string]string)}
+	for i, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		separator := strings.Index(line, "=")
+		if separator < 0 {
+			return nil, fmt.Errorf("failed to parse credentials file [path=%s][line=%d]", path, i+1)
+		}
+		provider.values[strings.TrimSpace(line[:separator])] = strings.TrimSpace(line[separator+1:])
+	}
+	return provider, nil
+}
+
+func (p *FileProvider) Credential(key, prompt string) (string, error) {
+	value := p.values[key]
+	if len(value) == 0 {
+		return "", fmt.Errorf("failed to find credential [key=%s][path=%s][err=%w]", key, p.path, ErrCredentialNotFound)
+	}
+	return value, nil
+}
+
+// ChainProvider asks each provider in turn and returns the first value found.
+type ChainProvider []CredentialProvider
+
+func (p ChainProvider) Credential(key, prompt string) (string, error) {
+	for _, provider := range p {
+		value, err := provider.Credential(key, prompt)
+		if !errors.Is(err, ErrCredentialNotFound) {
+			return value, err
+		}
+	}
+	return "", fmt.Errorf("failed to find credential [key=%s][err=%w]", key, ErrCredentialNotFound)
+}
+
+func credentialProvider(config ServiceConfig) CredentialProvider {
+	if config.CredentialProvider != nil {
+		return config.CredentialProvider
+	}
+	return StdinCredentials
+}
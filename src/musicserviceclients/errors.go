@@ -0,0 +1,89 @@
+package musicserviceclients
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+type FailureReason string
+
+const (
+	REASON_NOT_FOUND  FailureReason = "not found"
+	REASON_HTTP_ERROR FailureReason = "http error"
+	REASON_REJECTED   FailureReason = "rejected"
+)
+
+// SongError is the failure of a single song, categorized by why it failed.
+type SongError struct {
+	Song   Song
+	Reason FailureReason
+	Err    error
+}
+
+func (e *SongError) Error() string {
+	return fmt.Sprintf("failed song [song=%s][reason=%s][err=%v]", e.Song.Name, e.Reason, e.Err)
+}
+
+func (e *SongError) Unwrap() error {
+	return e.Err
+}
+
+// MultiError collects every failure of a batch operation. errors.Is and errors.As look at each
+// of them.
+type MultiError struct {
+	Errors []error
+}
+
+func (e *MultiError) Error() string {
+	var lines []string
+	for _, err := range e.Errors {
+		lines = append(lines, fmt.Sprintf("[err=%v]", err))
+	}
+	return fmt.Sprintf("%d errors:\n%s", len(e.Errors), strings.Join(lines, "\n"))
+}
+
+func (e *MultiError) Unwrap() []error {
+	return e.Errors
+}
+
+// SongErrors returns the failures that belong to a song.
+func (e *MultiError) SongErrors() []*SongError {
+	var songErrors []*SongError
+	for _, err := range e.Errors {
+		var songErr *SongError
+		if errors.As(err, &songErr) {
+			songErrors = append(songErrors, songErr)
+		}
+	}
+	return songErrors
+}
+
+// Count returns the number of songs that failed for reason.
+func (e *MultiError) Count(reason FailureReason) int {
+	count := 0
+	for _, songErr := range e.SongErrors() {
+		if songErr.Reason == reason {
+			count++
+		}
+	}
+	return count
+}
+
+// newMultiError returns nil for an empty list so it can be returned directly.
+func newMultiError(errorList []error) error {
+	if len(errorList) == 0 {
+		return nil
+	}
+	return &MultiError{Errors: errorList}
+}
+
+// failureReason classifies err as an HTTP error or, when the service answered but refused the
+// request, as a rejection.
+func failureReason(err error) FailureReason {
+	var httpErr *HttpError
+	if errors.As(err, &httpErr) {
+		return REASON_HTTP_ERROR
+	}
+	return REASON_REJECTED
+}
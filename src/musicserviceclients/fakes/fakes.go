@@ -0,0 +1,218 @@
+// Package fakes serves recorded Spotify and Google Play Music responses from a local
+// httptest server, so clients can be run end to end without network access.
+package fakes
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sync"
+)
+
+const (
+	SPOTIFY_API_PATH   = "/v1/"
+	SPOTIFY_TOKEN_PATH = "/api/token"
+	GPM_API_PATH       = "/sj/v2.5/"
+)
+
+const (
+	FIXTURES_SPOTIFY = "fixtures/spotify.json"
+	FIXTURES_GPM     = "fixtures/gpm.json"
+)
+
+//go:embed fixtures/*.json
+var fixtureFiles embed.FS
+
+// Fixture is a recorded response and the request it answers. Every query parameter of Path
+// must be present in the request, other parameters are ignored. When Request is set the JSON
+// body of the request must equal it.
+type Fixture struct {
+	Method   string            `json:"method"`
+	Path     string            `json:"path"`
+	Request  json.RawMessage   `json:"request,omitempty"`
+	Status   int               `json:"status,omitempty"`
+	Header   map[string]string `json:"header,omitempty"`
+	Response json.RawMessage   `json:"response,omitempty"`
+}
+
+// Request is a request the server received.
+type Request struct {
+	Method  string
+	Path    string
+	Query   url.Values
+	Body    []byte
+	Matched bool
+}
+
+// Server answers each request with the first fixture matching it. Several fixtures recorded
+// for the same request are replayed one after the other, the last one repeating once all of
+// them were used. Unmatched requests get a 404.
+type Server struct {
+	*httptest.Server
+	mu       sync.Mutex
+	fixtures []Fixture
+	replayed []bool
+	requests []Request
+}
+
+func NewServer(fixtures []Fixture) *Server {
+	server := &Server{fixtures: fixtures, replayed: make([]bool, len(fixtures))}
+	server.Server = httptest.NewServer(http.HandlerFunc(server.serve))
+	return server
+}
+
+// NewSpotifyServer replays the recorded Spotify fixtures. Point SpotifyConfig.BaseUrl at
+// SpotifyBaseUrl and TokenUrl at SpotifyTokenUrl.
+func NewSpotifyServer() (*Server, error) {
+	fixtures, err := loadFixtures(FIXTURES_SPOTIFY)
+	if err != nil {
+		return nil, err
+	}
+	return NewServer(fixtures), nil
+}
+
+// NewGpmServer replays the recorded Google Play Music fixtures. Point GpmConfig.BaseUrl at
+// GpmBaseUrl.
+func NewGpmServer() (*Server, error) {
+	fixtures, err := loadFixtures(FIXTURES_GPM)
+	if err != nil {
+		return nil, err
+	}
+	return NewServer(fixtures), nil
+}
+
+// loadFixtures reads one of the fixture files shipped with this package.
+func loadFixtures(name string) ([]Fixture, error) {
+	content, err := fixtureFiles.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fixtures [name=%s][err=%v]", name, err)
+	}
+	var fixtures []Fixture
+	err = json.Unmarshal(content, &fixtures)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse fixtures [name=%s][err=%v]", name, err)
+	}
+	return fixtures, nil
+}
+
+func (s *Server) SpotifyBaseUrl() string {
+	return s.URL + SPOTIFY_API_PATH
+}
+
+func (s *Server) SpotifyTokenUrl() string {
+	return s.URL + SPOTIFY_TOKEN_PATH
+}
+
+func (s *Server) GpmBaseUrl() string {
+	return s.URL + GPM_API_PATH
+}
+
+// Requests returns every request received so far, in order.
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request{}, s.requests...)
+}
+
+// Unmatched returns the requests no fixture answered.
+func (s *Server) Unmatched() []Request {
+	var unmatched []Request
+	for _, request := range s.Requests() {
+		if !request.Matched {
+			unmatched = append(unmatched, request)
+		}
+	}
+	return unmatched
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	request := Request{Method: r.Method, Path: r.URL.Path, Query: r.URL.Query(), Body: body}
+	s.mu.Lock()
+	fixture, ok := s.match(request)
+	request.Matched = ok
+	s.requests = append(s.requests, request)
+	s.mu.Unlock()
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprintf(w, `{"error":{"status":404,"message":"no fixture for %s %s"}}`, r.Method, r.URL.RequestURI())
+		return
+	}
+	for key, value := range fixture.Header {
+		w.Header().Set(key, value)
+	}
+	if len(fixture.Response) > 0 {
+		w.Header().Set("Content-Type", "application/json")
+	}
+	status := fixture.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	w.WriteHeader(status)
+	w.Write(fixture.Response)
+}
+
+// match must be called with the lock held. Fixtures recorded for the same request form a
+// sequence that is replayed in order.
+func (s *Server) match(request Request) (Fixture, bool) {
+	first := -1
+	last := -1
+	for i, fixture := range s.fixtures {
+		if first >= 0 && !sameRequest(s.fixtures[first], fixture) {
+			continue
+		}
+		if !matches(fixture, request) {
+			continue
+		}
+		if first < 0 {
+			first = i
+		}
+		if !s.replayed[i] {
+			s.replayed[i] = true
+			return fixture, true
+		}
+		last = i
+	}
+	if last < 0 {
+		return Fixture{}, false
+	}
+	return s.fixtures[last], true
+}
+
+func sameRequest(a, b Fixture) bool {
+	return a.Method == b.Method && a.Path == b.Path && bytes.Equal(a.Request, b.Request)
+}
+
+func matches(fixture Fixture, request Request) bool {
+	if fixture.Method != request.Method {
+		return false
+	}
+	fixtureUrl, err := url.Parse(fixture.Path)
+	if err != nil || fixtureUrl.Path != request.Path {
+		return false
+	}
+	for key, values := range fixtureUrl.Query() {
+		if !reflect.DeepEqual(values, request.Query[key]) {
+			return false
+		}
+	}
+	if len(fixture.Request) == 0 {
+		return true
+	}
+	var expected, actual interface{}
+	if json.Unmarshal(fixture.Request, &expected) != nil || json.Unmarshal(bytes.TrimSpace(request.Body), &actual) != nil {
+		return false
+	}
+	return reflect.DeepEqual(expected, actual)
+}
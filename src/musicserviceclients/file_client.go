@@ -0,0 +1,502 @@
+package musicserviceclients
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const SERVICE_FILE = "file"
+
+const (
+	FILE_EXTENSION_M3U  = ".m3u"
+	FILE_EXTENSION_M3U8 = ".m3u8"
+	FILE_EXTENSION_PLS  = ".pls"
+)
+
+const (
+	M3U_HEADER            = "#EXTM3U"
+	M3U_DIRECTIVE_INFO    = "#EXTINF:"
+	M3U_DIRECTIVE_ALBUM   = "#EXTALB:"
+	M3U_DIRECTIVE_ARTIST  = "#EXTART:"
+	M3U_DIRECTIVE_NAME    = "#PLAYLIST:"
+	M3U_DIRECTIVE_DESC    = "#DESCRIPTION:"
+	M3U_DIRECTIVE_IMAGE   = "#EXTIMG:"
+	PLS_SECTION           = "[playlist]"
+	FILE_ARTIST_SEPARATOR = " - "
+)
+
+type fileClient struct {
+	directory string
+	dryRun    bool
+}
+
+func init() {
+	RegisterService(Service{
+		Name:         SERVICE_FILE,
+		Description:  "M3U/M3U8/PLS files in a local directory",
+		Constructor:  NewFileClient,
+		Capabilities: CAPABILITY_READ | CAPABILITY_WRITE})
+}
+
+func NewFileClient(config ServiceConfig) (MediaServiceClient, error) {
+	if len(config.Directory) == 0 {
+		return nil, errors.New("a playlist directory is required for the file service")
+	}
+	return &fileClient{directory: config.Directory, dryRun: config.DryRun}, nil
+}
+
+func (c *fileClient) Login() error {
+	err := os.MkdirAll(c.directory, 0755)
+	if err != nil {
+		return fmt.Errorf("failed to open playlist directory [directory=%s][err=%v]", c.directory, err)
+	}
+	log.Printf("Using playlist directory %s", c.directory)
+	return nil
+}
+
+func (c *fileClient) ListPlaylist(playListName string) (*Playlist, error) {
+	playlists, err := c.ListAllPlaylists()
+	if err != nil {
+		return nil, err
+	}
+	for _, playlist := range playlists {
+		if SamePlaylistName(playlist.Name, playListName) {
+			return &playlist, nil
+		}
+	}
+	return nil, fmt.Errorf("failed to find playlist with [name=%s][err=%w]", playListName, ErrPlaylistNotFound)
+}
+
+func (c *fileClient) ListAllPlaylists() ([]Playlist, error) {
+	return c.ListPlaylists(nil)
+}
+
+// ListPlaylists filters after reading each file, the name is only known from its contents.
+func (c *fileClient) ListPlaylists(filter PlaylistFilter) ([]Playlist, error) {
+	files, err := ioutil.ReadDir(c.directory)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list playlist directory [directory=%s][err=%v]", c.directory, err)
+	}
+	var playlists []Playlist
+	for _, file := range files {
+		if file.IsDir() || !isPlaylistFile(file.Name()) {
+			continue
+		}
+		playlist, err := readPlaylistFile(filepath.Join(c.directory, file.Name()))
+		if err != nil {
+			return playlists, fmt.Errorf("Failed to retrieve playlist info [file=%s][err=%v]", file.Name(), err)
+		}
+		if filter != nil && !filter(playlist.Name, playlist.Id) {
+			continue
+		}
+		playlists = append(playlists, *playlist)
+	}
+	return playlists, nil
+}
+
+func (c *fileClient) GetPlaylist(playlistId string) (*Playlist, error) {
+	path := filepath.Join(c.directory, filepath.Base(playlistId))
+	playlist, err := readPlaylistFile(path)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to find playlist with [id=%s][err=%w]", playlistId, ErrPlaylistNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read playlist [file=%s][err=%v]", path, err)
+	}
+	return playlist, nil
+}
+
+// CreatePlaylist keeps the cover image URL in the file, visibility has no meaning for files.
+// Names that only differ in characters files cannot hold map to the same file name, so a
+// number is appended instead of overwriting an existing file.
+func (c *fileClient) CreatePlaylist(playlist Playlist) (*PlaylistResult, error) {
+	if c.dryRun {
+		return &PlaylistResult{Matches: fileMatches(playlist.Songs)}, nil
+	}
+	content := encodeM3u(Playlist{Name: playlist.Name, Description: playlist.Description, CoverImageUrl: playlist.CoverImageUrl, Songs: fileSongs(playlist.Songs)})
+	baseName := safeFileName(playlist.Name)
+	fileName := baseName + FILE_EXTENSION_M3U8
+	for n := 2; ; n++ {
+		path := filepath.Join(c.directory, fileName)
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if os.IsExist(err) {
+			fileName = fmt.Sprintf("%s (%d)%s", baseName, n, FILE_EXTENSION_M3U8)
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to create playlist [name=%s][file=%s][err=%v]", playlist.Name, path, err)
+		}
+		_, err = file.WriteString(content)
+		closeErr := file.Close()
+		if err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to write playlist [name=%s][file=%s][err=%v]", playlist.Name, path, err)
+		}
+		return &PlaylistResult{Id: fileName, Matches: fileMatches(playlist.Songs)}, nil
+	}
+}
+
+func (c *fileClient) AddTracks(playlistId string, songs []Song) ([]TrackMatch, error) {
+	if c.dryRun {
+		return fileMatches(songs), nil
+	}
+	path := filepath.Join(c.directory, filepath.Base(playlistId))
+	playlist, err := readPlaylistFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read playlist [file=%s][err=%v]", path, err)
+	}
+	playlist.Songs = append(playlist.Songs, fileSongs(songs)...)
+	err = writePlaylistFile(path, *playlist)
+	if err != nil {
+		return nil, fmt.Errorf("failed to write playlist [file=%s][err=%v]", path, err)
+	}
+	return fileMatches(songs), nil
+}
+
+func (c *fileClient) RemoveTracks(playlistId string, songs []Song) error {
+	if c.dryRun {
+		return nil
+	}
+	path := filepath.Join(c.directory, filepath.Base(playlistId))
+	playlist, err := readPlaylistFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read playlist [file=%s][err=%v]", path, err)
+	}
+	remaining := make(map[string]int)
+	for _, song := range songs {
+		remaining[song.Id]++
+	}
+	var kept []Song
+	for _, song := range playlist.Songs {
+		if remaining[song.Id] > 0 {
+			remaining[song.Id]--
+		} else {
+			kept = append(kept, song)
+		}
+	}
+	playlist.Songs = kept
+	err = writePlaylistFile(path, *playlist)
+	if err != nil {
+		return fmt.Errorf("failed to write playlist [file=%s][err=%v]", path, err)
+	}
+	return nil
+}
+
+// Playlist files carry no library, so none of the library methods are supported.
+func (c *fileClient) ListSavedTracks() ([]Song, error) {
+	return nil, fmt.Errorf("failed to list saved tracks [service=%s][err=%w]", SERVICE_FILE, errors.ErrUnsupported)
+}
+
+func (c *fileClient) ListSavedAlbums() ([]Album, error) {
+	return nil, fmt.Errorf("failed to list saved albums [service=%s][err=%w]", SERVICE_FILE, errors.ErrUnsupported)
+}
+
+func (c *fileClient) ListFollowedArtists() ([]Artist, error) {
+	return nil, fmt.Errorf("failed to list followed artists [service=%s][err=%w]", SERVICE_FILE, errors.ErrUnsupported)
+}
+
+func (c *fileClient) SaveTracks(songs []Song) ([]TrackMatch, error) {
+	return nil, fmt.Errorf("failed to save tracks [service=%s][err=%w]", SERVICE_FILE, errors.ErrUnsupported)
+}
+
+func (c *fileClient) SaveAlbums(albums []Album) ([]Album, error) {
+	return nil, fmt.Errorf("failed to save albums [service=%s][err=%w]", SERVICE_FILE, errors.ErrUnsupported)
+}
+
+func (c *fileClient) FollowArtists(artists []Artist) ([]Artist, error) {
+	return nil, fmt.Errorf("failed to follow artists [service=%s][err=%w]", SERVICE_FILE, errors.ErrUnsupported)
+}
+
+func isPlaylistFile(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case FILE_EXTENSION_M3U, FILE_EXTENSION_M3U8, FILE_EXTENSION_PLS:
+		return true
+	default:
+		return false
+	}
+}
+
+func readPlaylistFile(path string) (*Playlist, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	text := decodePlaylistText(content)
+	extension := filepath.Ext(path)
+	playlist := &Playlist{Name: strings.TrimSuffix(filepath.Base(path), extension), Id: filepath.Base(path)}
+	if strings.ToLower(extension) == FILE_EXTENSION_PLS {
+		playlist.Songs, err = parsePls(text)
+	} else {
+		err = parseM3u(text, playlist)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return playlist, nil
+}
+
+// Plain .m3u files are frequently Latin-1 encoded, so anything that is not valid UTF-8 is
+// treated as Latin-1.
+func decodePlaylistText(content []byte) string {
+	text := strings.TrimPrefix(string(content), "\ufeff")
+	if utf8.ValidString(text) {
+		return text
+	}
+	runes := make([]rune, len(content))
+	for i, b := range content {
+		runes[i] = rune(b)
+	}
+	return string(runes)
+}
+
+func parseM3u(text string, playlist *Playlist) error {
+	var current *Song
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case len(line) == 0 || line == M3U_HEADER:
+		case strings.HasPrefix(line, M3U_DIRECTIVE_NAME):
+			playlist.Name = strings.TrimSpace(strings.TrimPrefix(line, M3U_DIRECTIVE_NAME))
+		case strings.HasPrefix(line, M3U_DIRECTIVE_DESC):
+			playlist.Description = strings.TrimSpace(strings.TrimPrefix(line, M3U_DIRECTIVE_DESC))
+		case strings.HasPrefix(line, M3U_DIRECTIVE_IMAGE) && current == nil && len(playlist.Songs) == 0:
+			playlist.CoverImageUrl = strings.TrimSpace(strings.TrimPrefix(line, M3U_DIRECTIVE_IMAGE))
+		case strings.HasPrefix(line, M3U_DIRECTIVE_INFO):
+			info := strings.TrimPrefix(line, M3U_DIRECTIVE_INFO)
+			song := Song{}
+			if i := strings.Index(info, ","); i >= 0 {
+				song = songFromDisplayTitle(info[i+1:])
+				song.Duration = infoDuration(info[:i])
+			}
+			current = &song
+		case strings.HasPrefix(line, M3U_DIRECTIVE_ALBUM):
+			if current == nil {
+				current = &Song{}
+			}
+			current.Album = Album{Name: strings.TrimSpace(strings.TrimPrefix(line, M3U_DIRECTIVE_ALBUM))}
+		case strings.HasPrefix(line, M3U_DIRECTIVE_ARTIST):
+			if current == nil {
+				current = &Song{}
+			}
+			current.Artists = []Artist{{Name: strings.TrimSpace(strings.TrimPrefix(line, M3U_DIRECTIVE_ARTIST))}}
+		case strings.HasPrefix(line, "#"):
+		default:
+			if current == nil || len(current.Name) == 0 {
+				song := songFromLocation(line)
+				if current != nil {
+					song.Album = current.Album
+					if len(current.Artists) > 0 {
+						song.Artists = current.Artists
+					}
+				}
+				current = &song
+			}
+			current.Id = line
+			current.ServiceIds = serviceIds(SERVICE_FILE, line, "")
+			playlist.Songs = append(playlist.Songs, *current)
+			current = nil
+		}
+	}
+	return scanner.Err()
+}
+
+func parsePls(text string) ([]Song, error) {
+	files := make(map[int]string)
+	titles := make(map[int]string)
+	lengths := make(map[int]string)
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.EqualFold(line, PLS_SECTION) || strings.HasPrefix(line, ";") {
+			continue
+		}
+		i := strings.Index(line, "=")
+		if i < 0 {
+			return nil, fmt.Errorf("failed to parse pls line [line=%s]", line)
+		}
+		key := strings.ToLower(strings.TrimSpace(line[:i]))
+		value := strings.TrimSpace(line[i+1:])
+		switch {
+		case strings.HasPrefix(key, "file"):
+			if index, err := strconv.Atoi(key[len("file"):]); err == nil {
+				files[index] = value
+			}
+		case strings.HasPrefix(key, "title"):
+			if index, err := strconv.Atoi(key[len("title"):]); err == nil {
+				titles[index] = value
+			}
+		case strings.HasPrefix(key, "length"):
+			if index, err := strconv.Atoi(key[len("length"):]); err == nil {
+				lengths[index] = value
+			}
+		}
+	}
+	if scanner.Err() != nil {
+		return nil, scanner.Err()
+	}
+	var indexes []int
+	for index := range files {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+	var songs []Song
+	for _, index := range indexes {
+		song := songFromLocation(files[index])
+		if title, ok := titles[index]; ok && len(title) > 0 {
+			song = songFromDisplayTitle(title)
+		}
+		song.Id = files[index]
+		song.ServiceIds = serviceIds(SERVICE_FILE, files[index], "")
+		song.Duration = infoDuration(lengths[index])
+		songs = append(songs, song)
+	}
+	return songs, nil
+}
+
+func writePlaylistFile(path string, playlist Playlist) error {
+	if strings.ToLower(filepath.Ext(path)) == FILE_EXTENSION_PLS {
+		return writePls(path, playlist)
+	}
+	return writeM3u(path, playlist)
+}
+
+func writeM3u(path string, playlist Playlist) error {
+	return ioutil.WriteFile(path, []byte(encodeM3u(playlist)), 0644)
+}
+
+func encodeM3u(playlist Playlist) string {
+	var builder strings.Builder
+	builder.WriteString(M3U_HEADER + "\n")
+	builder.WriteString(M3U_DIRECTIVE_NAME + singleLine(playlist.Name) + "\n")
+	if len(playlist.Description) > 0 {
+		builder.WriteString(M3U_DIRECTIVE_DESC + singleLine(playlist.Description) + "\n")
+	}
+	if len(playlist.CoverImageUrl) > 0 {
+		builder.WriteString(M3U_DIRECTIVE_IMAGE + singleLine(playlist.CoverImageUrl) + "\n")
+	}
+	for _, song := range playlist.Songs {
+		builder.WriteString(fmt.Sprintf("%s%d,%s\n", M3U_DIRECTIVE_INFO, fileSeconds(song.Duration), songDisplayTitle(song)))
+		if len(song.Album.Name) > 0 {
+			builder.WriteString(M3U_DIRECTIVE_ALBUM + singleLine(song.Album.Name) + "\n")
+		}
+		builder.WriteString(song.Id + "\n")
+	}
+	return builder.String()
+}
+
+func writePls(path string, playlist Playlist) error {
+	var builder strings.Builder
+	builder.WriteString(PLS_SECTION + "\n")
+	for i, song := range playlist.Songs {
+		builder.WriteString(fmt.Sprintf("File%d=%s\n", i+1, song.Id))
+		builder.WriteString(fmt.Sprintf("Title%d=%s\n", i+1, songDisplayTitle(song)))
+		builder.WriteString(fmt.Sprintf("Length%d=%d\n", i+1, fileSeconds(song.Duration)))
+	}
+	builder.WriteString(fmt.Sprintf("NumberOfEntries=%d\nVersion=2\n", len(playlist.Songs)))
+	return ioutil.WriteFile(path, []byte(builder.String()), 0644)
+}
+
+// fileMatches reports every song as matched, files hold whatever songs they are given.
+func fileMatches(songs []Song) []TrackMatch {
+	var matches []TrackMatch
+	for i, track := range fileSongs(songs) {
+		written := track
+		matches = append(matches, TrackMatch{Source: songs[i], Track: &written, Score: 1, Status: MATCH_MATCHED})
+	}
+	return matches
+}
+
+// Songs read from playlist files keep their location. Songs coming from other services have
+// none, so one is derived from the artist and title.
+func fileSongs(songs []Song) []Song {
+	var located []Song
+	for _, song := range songs {
+		location := song.ServiceIds[SERVICE_FILE].Id
+		if len(location) == 0 {
+			location = safeFileName(songDisplayTitle(song))
+		}
+		song.Id = location
+		song.ServiceIds = serviceIds(SERVICE_FILE, location, "")
+		located = append(located, song)
+	}
+	return located
+}
+
+// Durations are whole seconds in playlist files, where -1 means unknown.
+func infoDuration(value string) time.Duration {
+	fields := strings.Fields(value)
+	if len(fields) == 0 {
+		return 0
+	}
+	seconds, err := strconv.Atoi(fields[0])
+	if err != nil || seconds <= 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+func fileSeconds(duration time.Duration) int {
+	if duration <= 0 {
+		return -1
+	}
+	return int((duration + time.Second/2) / time.Second)
+}
+
+// songDisplayTitle only names the first artist. Joining them all would read back as one artist
+// that matches none of them.
+func songDisplayTitle(song Song) string {
+	if len(song.Artists) == 0 {
+		return singleLine(song.Name)
+	}
+	return singleLine(song.Artists[0].Name + FILE_ARTIST_SEPARATOR + song.Name)
+}
+
+func songFromDisplayTitle(title string) Song {
+	title = strings.TrimSpace(title)
+	i := strings.Index(title, FILE_ARTIST_SEPARATOR)
+	if i < 0 {
+		return Song{Name: title}
+	}
+	return Song{
+		Name:    strings.TrimSpace(title[i+len(FILE_ARTIST_SEPARATOR):]),
+		Artists: []Artist{{Name: strings.TrimSpace(title[:i])}}}
+}
+
+func songFromLocation(location string) Song {
+	location = strings.Replace(location, "\\", "/", -1)
+	base := location[strings.LastIndex(location, "/")+1:]
+	if extension := filepath.Ext(base); len(extension) <= 5 && !strings.Contains(extension, " ") {
+		base = strings.TrimSuffix(base, extension)
+	}
+	return songFromDisplayTitle(base)
+}
+
+func singleLine(value string) string {
+	return strings.Join(strings.Fields(value), " ")
+}
+
+func safeFileName(value string) string {
+	name := strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`/\:*?"<>|`, r) || r < ' ' {
+			return '_'
+		}
+		return r
+	}, strings.TrimSpace(value))
+	if len(name) == 0 || name == "." || name == ".." {
+		return "untitled"
+	}
+	return name
+}
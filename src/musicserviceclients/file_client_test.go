@@ -0,0 +1,93 @@
+package musicserviceclients
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFileRoundTrip(t *testing.T) {
+	songs := []Song{
+		{Name: "Stay", Artists: []Artist{{Name: "The Kid LAROI"}, {Name: "Justin Bieber"}}, Album: Album{Name: "F*ck Love 3"}, Duration: 141 * time.Second},
+		{Name: "Mr. Brightside", Artists: []Artist{{Name: "The Killers"}}, Album: Album{Name: "Hot Fuss"}, Duration: 222 * time.Second},
+		{Name: "Untitled"},
+		{Name: "Intro", Id: "Music/Intro.mp3", ServiceIds: map[string]ServiceId{SERVICE_FILE: {Id: "Music/Intro.mp3"}}},
+	}
+	tests := []struct {
+		extension string
+		expected  []Song
+	}{
+		{FILE_EXTENSION_M3U8, []Song{
+			{Name: "Stay", Artists: []Artist{{Name: "The Kid LAROI"}}, Album: Album{Name: "F*ck Love 3"}, Duration: 141 * time.Second, Id: "The Kid LAROI - Stay"},
+			{Name: "Mr. Brightside", Artists: []Artist{{Name: "The Killers"}}, Album: Album{Name: "Hot Fuss"}, Duration: 222 * time.Second, Id: "The Killers - Mr. Brightside"},
+			{Name: "Untitled", Id: "Untitled"},
+			{Name: "Intro", Id: "Music/Intro.mp3"}}},
+		{FILE_EXTENSION_M3U, []Song{
+			{Name: "Stay", Artists: []Artist{{Name: "The Kid LAROI"}}, Album: Album{Name: "F*ck Love 3"}, Duration: 141 * time.Second, Id: "The Kid LAROI - Stay"},
+			{Name: "Mr. Brightside", Artists: []Artist{{Name: "The Killers"}}, Album: Album{Name: "Hot Fuss"}, Duration: 222 * time.Second, Id: "The Killers - Mr. Brightside"},
+			{Name: "Untitled", Id: "Untitled"},
+			{Name: "Intro", Id: "Music/Intro.mp3"}}},
+		{FILE_EXTENSION_PLS, []Song{
+			{Name: "Stay", Artists: []Artist{{Name: "The Kid LAROI"}}, Duration: 141 * time.Second, Id: "The Kid LAROI - Stay"},
+			{Name: "Mr. Brightside", Artists: []Artist{{Name: "The Killers"}}, Duration: 222 * time.Second, Id: "The Killers - Mr. Brightside"},
+			{Name: "Untitled", Id: "Untitled"},
+			{Name: "Intro", Id: "Music/Intro.mp3"}}},
+	}
+	for _, test := range tests {
+		t.Run(test.extension, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "Road Trip"+test.extension)
+			err := writePlaylistFile(path, Playlist{Name: "Road Trip", Songs: fileSongs(songs)})
+			if err != nil {
+				t.Fatalf("writePlaylistFile() failed [err=%v]", err)
+			}
+			playlist, err := readPlaylistFile(path)
+			if err != nil {
+				t.Fatalf("readPlaylistFile() failed [err=%v]", err)
+			}
+			if playlist.Name != "Road Trip" {
+				t.Errorf("read playlist %s, want Road Trip", playlist.Name)
+			}
+			for i := range test.expected {
+				test.expected[i].ServiceIds = serviceIds(SERVICE_FILE, test.expected[i].Id, "")
+			}
+			if !reflect.DeepEqual(playlist.Songs, test.expected) {
+				t.Errorf("read songs\n%+v\nwant\n%+v", playlist.Songs, test.expected)
+			}
+			for i, song := range playlist.Songs {
+				if SongKey(song) != SongKey(songs[i]) {
+					t.Errorf("song %d reads back as %s, want %s", i, SongKey(song), SongKey(songs[i]))
+				}
+			}
+		})
+	}
+}
+
+func TestFileCreatePlaylistCollision(t *testing.T) {
+	client := &fileClient{directory: t.TempDir()}
+	names := []string{"Rock/Pop", "Rock:Pop", "Rock_Pop"}
+	expected := []string{"Rock_Pop.m3u8", "Rock_Pop (2).m3u8", "Rock_Pop (3).m3u8"}
+	for i, name := range names {
+		result, err := client.CreatePlaylist(Playlist{Name: name, Description: "Playlist " + name, CoverImageUrl: "https://example.com/" + name + ".jpg",
+			Songs: []Song{{Name: name, Artists: []Artist{{Name: "Various Artists"}}}}})
+		if err != nil {
+			t.Fatalf("CreatePlaylist() failed [name=%s][err=%v]", name, err)
+		}
+		if result.Id != expected[i] {
+			t.Errorf("CreatePlaylist(%s) wrote %s, want %s", name, result.Id, expected[i])
+		}
+	}
+	for i, name := range names {
+		playlist, err := client.GetPlaylist(expected[i])
+		if err != nil {
+			t.Fatalf("GetPlaylist() failed [id=%s][err=%v]", expected[i], err)
+		}
+		if playlist.Name != name || playlist.Description != "Playlist "+name || playlist.CoverImageUrl != "https://example.com/"+name+".jpg" {
+			t.Errorf("GetPlaylist(%s) = [name=%s][description=%s][cover=%s], want the playlist named %s",
+				expected[i], playlist.Name, playlist.Description, playlist.CoverImageUrl, name)
+		}
+		if len(playlist.Songs) != 1 || playlist.Songs[0].Name != name {
+			t.Errorf("GetPlaylist(%s) returned songs %+v, want %s", expected[i], playlist.Songs, name)
+		}
+	}
+}
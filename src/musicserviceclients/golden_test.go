@@ -0,0 +1,50 @@
+package musicserviceclients
+
+import (
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files under testdata")
+
+// readTestdata decodes the JSON file at testdata/path into v.
+func readTestdata(t *testing.T, path string, v interface{}) {
+	t.Helper()
+	content, err := ioutil.ReadFile(filepath.Join("testdata", path))
+	if err != nil {
+		t.Fatalf("failed to read testdata [path=%s][err=%v]", path, err)
+	}
+	err = json.Unmarshal(content, v)
+	if err != nil {
+		t.Fatalf("failed to parse testdata [path=%s][err=%v]", path, err)
+	}
+}
+
+// assertGolden compares actual encoded as JSON with testdata/path, or rewrites the file when
+// the tests run with -update.
+func assertGolden(t *testing.T, path string, actual interface{}) {
+	t.Helper()
+	encoded, err := json.MarshalIndent(actual, "", "  ")
+	if err != nil {
+		t.Fatalf("failed to encode result [path=%s][err=%v]", path, err)
+	}
+	encoded = append(encoded, '\n')
+	golden := filepath.Join("testdata", path)
+	if *update {
+		err = ioutil.WriteFile(golden, encoded, 0644)
+		if err != nil {
+			t.Fatalf("failed to write golden file [path=%s][err=%v]", golden, err)
+		}
+		return
+	}
+	expected, err := ioutil.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("failed to read golden file [path=%s][err=%v]", golden, err)
+	}
+	if string(expected) != string(encoded) {
+		t.Errorf("result differs from %s, rerun with -update if the change is intended\ngot:\n%s\nwant:\n%s", golden, encoded, expected)
+	}
+}
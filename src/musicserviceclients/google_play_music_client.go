@@ -1,7 +1,6 @@
 package musicserviceclients
 
 import (
-	"bufio"
 	"bytes"
 	"encoding/json"
 	"errors"
@@ -13,91 +12,486 @@ import (
 	"musicserviceclients/models"
 	"net/http"
 	"net/url"
-	"os"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 	"uuid"
 )
 
+const SERVICE_GOOGLE_PLAY_MUSIC = "gpm"
+
 const GPM_OAUTH_SERVICE = "sj"
 
 const MAX_GPM_SEARCH_RESULTS = "10"
 
+const MAX_GPM_FEED_RESULTS = "1000"
+
 const BASE_GPM_URI = "https://mclients.googleapis.com/sj/v2.5/"
 
 const (
 	PATH_GPM_CREATE_PLAYLIST       = "playlistbatch"
 	PATH_GPM_SEARCH                = "query"
 	PATH_GPM_ADD_SONGS_TO_PLAYLIST = "plentriesbatch"
+	PATH_GPM_PLAYLIST_FEED         = "playlistfeed"
+	PATH_GPM_PLAYLIST_ENTRY_FEED   = "plentryfeed"
+	PATH_GPM_TRACK_FEED            = "trackfeed"
+	PATH_GPM_FETCH_TRACK           = "fetchtrack?nid=%s"
+	PATH_GPM_FETCH_ALBUM           = "fetchalbum?nid=%s&include-tracks=true"
+	PATH_GPM_TRACK_BATCH           = "trackbatch"
 )
 
+// Search result and content types.
+const (
+	GPM_TYPE_TRACK = "1"
+	GPM_TYPE_ALBUM = "3"
+)
+
+// The feeds are read with POST requests, which are safe to repeat.
+var gpmReadPaths = map[string]bool{
+	PATH_GPM_PLAYLIST_FEED:       true,
+	PATH_GPM_PLAYLIST_ENTRY_FEED: true,
+	PATH_GPM_TRACK_FEED:          true,
+}
+
+// GpmConfig points the client at another API endpoint and replaces the gpsoauth login, which
+// always talks to Google.
+type GpmConfig struct {
+	BaseUrl      string
+	Authenticate GpmAuthenticator
+}
+
+// GpmAuthenticator exchanges a username and password for an OAuth token.
+type GpmAuthenticator func(username, password string) (string, error)
+
 type googlePlayMusicClient struct {
-	oAuthToken string
-	client     *http.Client
+	baseUrl       string
+	authenticate  GpmAuthenticator
+	newEntryId    func() string
+	oAuthToken    string
+	transport     *httpTransport
+	libraryTracks map[string]models.TrackItem
+	resolver      *trackResolver
+	credentials   CredentialCache
+	provider      CredentialProvider
+	account       string
+	dryRun        bool
 }
 
-func NewGooglePlayMusicClient() (MediaServiceClient, error) {
-	client := &http.Client{}
-	return &googlePlayMusicClient{client: client}, nil
+func init() {
+	RegisterService(Service{
+		Name:         SERVICE_GOOGLE_PLAY_MUSIC,
+		Description:  "Google Play Music",
+		Constructor:  NewGooglePlayMusicClient,
+		Capabilities: CAPABILITY_READ | CAPABILITY_WRITE | CAPABILITY_SEARCH | CAPABILITY_LIBRARY})
+}
+
+func NewGooglePlayMusicClient(config ServiceConfig) (MediaServiceClient, error) {
+	client := &googlePlayMusicClient{
+		baseUrl:      baseUrl(config.Gpm.BaseUrl, BASE_GPM_URI),
+		authenticate: config.Gpm.Authenticate,
+		transport:    newHttpTransport(SERVICE_GOOGLE_PLAY_MUSIC, httpClient(config), config.RetryPolicy, NewRateLimiter(config.RequestsPerSecond)),
+		credentials:  config.Credentials,
+		provider:     credentialProvider(config),
+		account:      config.Account,
+		dryRun:       config.DryRun}
+	if client.authenticate == nil {
+		client.authenticate = gpsoauthLogin
+	}
+	client.newEntryId = func() string {
+		return uuid.NewUUID().String()
+	}
+	client.resolver = newTrackResolver(client, config)
+	return client, nil
+}
+
+func gpsoauthLogin(username, password string) (string, error) {
+	return gpsoauth.Login(username, password, gpsoauth.GetNode(), GPM_OAUTH_SERVICE)
 }
 
 func (c *googlePlayMusicClient) Login() error {
-	reader := bufio.NewReader(os.Stdin)
+	if c.credentials != nil {
+		if credential, ok := c.credentials.Credential(SERVICE_GOOGLE_PLAY_MUSIC, c.account); ok {
+			log.Printf("Using cached Google Play Music credential [account=%s]", credential.Account)
+			c.oAuthToken = credential.Secret
+			return nil
+		}
+	}
 	log.Println("If you are using Gmail 2 factor authentication please create a app specific password at https://security.google.com/settings/security/apppasswords and use that.")
-	log.Print("Enter gmail id: ")
-	username, err := reader.ReadString('\n')
-	if err != nil {
-		return fmt.Errorf("failed to get username %v", err)
+	username := c.account
+	if len(username) == 0 {
+		var err error
+		username, err = c.provider.Credential(CREDENTIAL_GPM_USERNAME, "Enter gmail id: ")
+		if err != nil {
+			return fmt.Errorf("failed to get username %v", err)
+		}
 	}
-	log.Print("Enter gmail password: ")
-	password, err := reader.ReadString('\n')
+	password, err := c.provider.Credential(CREDENTIAL_GPM_PASSWORD, "Enter gmail password: ")
 	if err != nil {
 		return fmt.Errorf("failed to get password %v", err)
 	}
-	oAuthToken, err := gpsoauth.Login(username, password, gpsoauth.GetNode(), GPM_OAUTH_SERVICE)
+	oAuthToken, err := c.authenticate(username, password)
 	if err != nil {
 		return fmt.Errorf("failed to get master token %v", err)
 	}
 	c.oAuthToken = oAuthToken
+	if c.credentials != nil {
+		err = c.credentials.SaveCredential(SERVICE_GOOGLE_PLAY_MUSIC, Credential{Account: strings.TrimSpace(username), Secret: oAuthToken})
+		if err != nil {
+			log.Printf("Failed to cache Google Play Music credential [err=%v]", err)
+		}
+	}
 	return nil
 }
 
 func (c *googlePlayMusicClient) ListPlaylist(playListName string) (*Playlist, error) {
-	return nil, errors.New("Unimplemented function")
+	gpmPlaylists, err := c.getPlaylists()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list of user playlists [err=%v]", err)
+	}
+	for _, gpmPlaylist := range gpmPlaylists {
+		if SamePlaylistName(gpmPlaylist.Name, playListName) {
+			entries, err := c.getPlaylistEntries()
+			if err != nil {
+				return nil, fmt.Errorf("failed to list playlist entries [name=%s][err=%v]", playListName, err)
+			}
+			playlist, err := c.getPlaylist(gpmPlaylist, entries[gpmPlaylist.Id])
+			if err != nil {
+				return nil, fmt.Errorf("Failed to retrieve playlist info [name=%s][err=%v]", playListName, err)
+			}
+			return playlist, nil
+		}
+	}
+	return nil, fmt.Errorf("failed to find playlist with [name=%s][err=%w]", playListName, ErrPlaylistNotFound)
+}
+
+func (c *googlePlayMusicClient) GetPlaylist(playlistId string) (*Playlist, error) {
+	gpmPlaylists, err := c.getPlaylists()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list of user playlists [err=%v]", err)
+	}
+	for _, gpmPlaylist := range gpmPlaylists {
+		if gpmPlaylist.Id == playlistId {
+			entries, err := c.getPlaylistEntries()
+			if err != nil {
+				return nil, fmt.Errorf("failed to list playlist entries [id=%s][err=%v]", playlistId, err)
+			}
+			return c.getPlaylist(gpmPlaylist, entries[gpmPlaylist.Id])
+		}
+	}
+	return nil, fmt.Errorf("failed to find playlist with [id=%s][err=%w]", playlistId, ErrPlaylistNotFound)
 }
 
 func (c *googlePlayMusicClient) ListAllPlaylists() ([]Playlist, error) {
-	return nil, errors.New("Unimplemented function")
+	return c.ListPlaylists(nil)
 }
 
-func (c *googlePlayMusicClient) CreatePlaylist(playlistName, playListDescription string, songs []Song) error {
-	id, err := c.createNewPlaylist(playlistName, playListDescription)
+func (c *googlePlayMusicClient) ListPlaylists(filter PlaylistFilter) ([]Playlist, error) {
+	var playlists []Playlist
+	gpmPlaylists, err := c.getPlaylists()
 	if err != nil {
-		return fmt.Errorf("failed to create new empty playlist [name=%s][description=%s][err=%v]", playlistName, playListDescription, err)
+		return nil, fmt.Errorf("failed to list of user playlists [err=%v]", err)
 	}
-	err = c.addTracksToPlaylist(id, songs)
+	entries, err := c.getPlaylistEntries()
 	if err != nil {
-		return fmt.Errorf("failed to add the following songs %v", err)
+		return nil, fmt.Errorf("failed to list playlist entries [err=%v]", err)
+	}
+	for _, gpmPlaylist := range gpmPlaylists {
+		if filter != nil && !filter(gpmPlaylist.Name, gpmPlaylist.Id) {
+			continue
+		}
+		playlist, err := c.getPlaylist(gpmPlaylist, entries[gpmPlaylist.Id])
+		if err != nil {
+			return playlists, fmt.Errorf("Failed to retrieve playlist info [name=%s][err=%v]", gpmPlaylist.Name, err)
+		}
+		playlists = append(playlists, *playlist)
+	}
+	return playlists, nil
+}
+
+func (c *googlePlayMusicClient) getPlaylists() ([]models.GpmPlaylist, error) {
+	var playlists []models.GpmPlaylist
+	startToken := ""
+	for {
+		response, err := c.feedPage(PATH_GPM_PLAYLIST_FEED, startToken)
+		if err != nil {
+			return nil, err
+		}
+		dec := json.NewDecoder(strings.NewReader(response))
+		var responseObj models.GpmPlaylistFeedResponse
+		err = dec.Decode(&responseObj)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse response [response=%s][err=%v]", response, err)
+		}
+		for _, playlist := range responseObj.Data.Items {
+			if !playlist.Deleted {
+				playlists = append(playlists, playlist)
+			}
+		}
+		startToken = responseObj.NextPageToken
+		if len(startToken) == 0 {
+			break
+		}
+	}
+	return playlists, nil
+}
+
+// The entry feed covers every playlist of the user, so entries are grouped by playlist id.
+func (c *googlePlayMusicClient) getPlaylistEntries() (map[string][]models.GpmPlaylistEntry, error) {
+	entries := make(map[string][]models.GpmPlaylistEntry)
+	startToken := ""
+	for {
+		response, err := c.feedPage(PATH_GPM_PLAYLIST_ENTRY_FEED, startToken)
+		if err != nil {
+			return nil, err
+		}
+		dec := json.NewDecoder(strings.NewReader(response))
+		var responseObj models.GpmPlaylistEntryFeedResponse
+		err = dec.Decode(&responseObj)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse response [response=%s][err=%v]", response, err)
+		}
+		for _, entry := range responseObj.Data.Items {
+			if !entry.Deleted {
+				entries[entry.PlayListId] = append(entries[entry.PlayListId], entry)
+			}
+		}
+		startToken = responseObj.NextPageToken
+		if len(startToken) == 0 {
+			break
+		}
+	}
+	for _, playlistEntries := range entries {
+		sort.SliceStable(playlistEntries, func(i, j int) bool {
+			return gpmPositionLess(playlistEntries[i].AbsolutePosition, playlistEntries[j].AbsolutePosition)
+		})
+	}
+	return entries, nil
+}
+
+// Absolute positions are numbers sent as strings that are not always zero padded to the same
+// width, so they are compared as integers. Unparsable positions go last in string order.
+func gpmPositionLess(a, b string) bool {
+	positionA, errA := strconv.ParseInt(a, 10, 64)
+	positionB, errB := strconv.ParseInt(b, 10, 64)
+	if errA == nil && errB == nil {
+		return positionA < positionB
+	} else if errA == nil || errB == nil {
+		return errA == nil
+	} else {
+		return a < b
+	}
+}
+
+func (c *googlePlayMusicClient) getPlaylist(gpmPlaylist models.GpmPlaylist, entries []models.GpmPlaylistEntry) (*Playlist, error) {
+	var songs []Song
+	for _, entry := range entries {
+		track, err := c.getTrack(entry)
+		if err != nil {
+			return nil, err
+		}
+		song := gpmMediaSong(*track)
+		song.Id = entry.SongId
+		song.ServiceIds = serviceIds(SERVICE_GOOGLE_PLAY_MUSIC, entry.SongId, "")
+		songs = append(songs, song)
+	}
+	return gpmMediaPlaylist(gpmPlaylist, songs), nil
+}
+
+func gpmMediaPlaylist(gpmPlaylist models.GpmPlaylist, songs []Song) *Playlist {
+	playlist := &Playlist{Name: gpmPlaylist.Name, Description: gpmPlaylist.Description, Id: gpmPlaylist.Id, Songs: songs}
+	switch gpmPlaylist.ShareState {
+	case models.GPM_PLAYLIST_SHARESTATE_PUBLIC:
+		playlist.Visibility = VISIBILITY_PUBLIC
+	case models.GPM_PLAYLIST_SHARESTATE_PRIVATE:
+		playlist.Visibility = VISIBILITY_PRIVATE
+	}
+	if len(gpmPlaylist.AlbumArtRef) > 0 {
+		playlist.CoverImageUrl = gpmPlaylist.AlbumArtRef[0].Url
+	}
+	return playlist
+}
+
+func (c *googlePlayMusicClient) getTrack(entry models.GpmPlaylistEntry) (*models.TrackItem, error) {
+	if entry.Track != nil {
+		return entry.Track, nil
+	}
+	libraryTracks, err := c.cachedLibraryTracks()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list library tracks [err=%v]", err)
+	}
+	if track, ok := libraryTracks[entry.SongId]; ok {
+		return &track, nil
+	}
+	response, err := c.makeRequest(http.MethodGet, fmt.Sprintf(PATH_GPM_FETCH_TRACK, url.QueryEscape(entry.SongId)), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch track [id=%s][err=%v]", entry.SongId, err)
+	}
+	dec := json.NewDecoder(strings.NewReader(response))
+	var track models.TrackItem
+	err = dec.Decode(&track)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse response [response=%s][err=%v]", response, err)
+	}
+	return &track, nil
+}
+
+func (c *googlePlayMusicClient) getLibraryTracks() (map[string]models.TrackItem, error) {
+	tracks := make(map[string]models.TrackItem)
+	startToken := ""
+	for {
+		response, err := c.feedPage(PATH_GPM_TRACK_FEED, startToken)
+		if err != nil {
+			return nil, err
+		}
+		dec := json.NewDecoder(strings.NewReader(response))
+		var responseObj models.GpmTrackFeedResponse
+		err = dec.Decode(&responseObj)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse response [response=%s][err=%v]", response, err)
+		}
+		for _, track := range responseObj.Data.Items {
+			tracks[track.LibraryId] = track
+		}
+		startToken = responseObj.NextPageToken
+		if len(startToken) == 0 {
+			break
+		}
+	}
+	return tracks, nil
+}
+
+func (c *googlePlayMusicClient) feedPage(path, startToken string) (string, error) {
+	request := &models.GpmFeedRequest{MaxResults: MAX_GPM_FEED_RESULTS, StartToken: startToken}
+	jsonRequest, err := json.Marshal(request)
+	if err != nil {
+		return "", fmt.Errorf("failed to create json request [err=%v]", err)
+	}
+	response, err := c.makeRequest(http.MethodPost, path, bytes.NewReader(jsonRequest))
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch feed [path=%s][starttoken=%s][err=%v]", path, startToken, err)
+	}
+	return response, nil
+}
+
+// CreatePlaylist keeps whether playlist is public. Google Play Music has no collaborative
+// playlists and no way to upload a cover image, its covers are made from the album art.
+func (c *googlePlayMusicClient) CreatePlaylist(playlist Playlist) (*PlaylistResult, error) {
+	result := &PlaylistResult{}
+	if !c.dryRun {
+		id, err := c.createNewPlaylist(playlist)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create new empty playlist [name=%s][description=%s][err=%v]", playlist.Name, playlist.Description, err)
+		}
+		result.Id = id
+	}
+	matches, err := c.addTracksToPlaylist(result.Id, playlist.Songs)
+	result.Matches = matches
+	if err != nil {
+		return result, fmt.Errorf("failed to add the following songs %w", err)
+	}
+	return result, nil
+}
+
+func (c *googlePlayMusicClient) AddTracks(playlistId string, songs []Song) ([]TrackMatch, error) {
+	return c.addTracksToPlaylist(playlistId, songs)
+}
+
+// RemoveTracks removes one entry of the track for every song, starting from the end of the
+// playlist where diffSongs leaves the unpaired duplicates, like the Spotify client does.
+func (c *googlePlayMusicClient) RemoveTracks(playlistId string, songs []Song) error {
+	if c.dryRun {
+		return nil
+	}
+	entries, err := c.getPlaylistEntries()
+	if err != nil {
+		return fmt.Errorf("failed to list playlist entries [id=%s][err=%v]", playlistId, err)
+	}
+	var errorList []error
+	remaining := make(map[string]int)
+	songsById := make(map[string]Song)
+	for _, song := range songs {
+		if len(song.Id) == 0 {
+			errorList = append(errorList, &SongError{Song: song, Reason: REASON_NOT_FOUND, Err: errors.New("failed to remove track without id")})
+		} else {
+			remaining[song.Id]++
+			songsById[song.Id] = song
+		}
+	}
+	var deleteEntries []models.GpmDeleteSongEntry
+	var removing []Song
+	playlistEntries := entries[playlistId]
+	for i := len(playlistEntries) - 1; i >= 0; i-- {
+		entry := playlistEntries[i]
+		if remaining[entry.SongId] > 0 {
+			remaining[entry.SongId]--
+			deleteEntries = append(deleteEntries, models.GpmDeleteSongEntry{Delete: entry.Id})
+			removing = append(removing, songsById[entry.SongId])
+		}
+	}
+	for id, count := range remaining {
+		if count > 0 {
+			errorList = append(errorList, &SongError{Song: songsById[id], Reason: REASON_NOT_FOUND, Err: fmt.Errorf("failed to find playlist entry [playlist=%s][track=%s]", playlistId, id)})
+		}
+	}
+	if len(deleteEntries) > 0 {
+		jsonRequest, err := json.Marshal(models.GpmDeleteSongEntryMutations{Mutations: deleteEntries})
+		if err != nil {
+			errorList = append(errorList, fmt.Errorf("failed to create json request [err=%v]", err))
+		} else {
+			response, err := c.makeRequest(http.MethodPost, PATH_GPM_ADD_SONGS_TO_PLAYLIST, bytes.NewReader(jsonRequest))
+			if err != nil {
+				err = fmt.Errorf("failed to remove songs from playlist [id=%s][err=%w]", playlistId, err)
+				for _, song := range removing {
+					errorList = append(errorList, &SongError{Song: song, Reason: failureReason(err), Err: err})
+				}
+			} else {
+				dec := json.NewDecoder(strings.NewReader(response))
+				var responseObj models.GpmAddTracksMutationsResponse
+				err = dec.Decode(&responseObj)
+				if err != nil {
+					errorList = append(errorList, fmt.Errorf("failed to parse response [response=%s][err=%v]", response, err))
+				}
+				for i, responseEntry := range responseObj.Response {
+					if responseEntry.ResponseCode != "OK" {
+						entryErr := fmt.Errorf("failed to remove entry [id=%s][responsecode=%s]", responseEntry.Id, responseEntry.ResponseCode)
+						if i < len(removing) {
+							entryErr = &SongError{Song: removing[i], Reason: REASON_REJECTED, Err: entryErr}
+						}
+						errorList = append(errorList, entryErr)
+					}
+				}
+			}
+		}
+	}
+	if len(errorList) == 0 {
+		return nil
+	} else {
+		return newMultiError(errorList)
 	}
-	return nil
 }
 
-func (c *googlePlayMusicClient) createNewPlaylist(playlistName, playListDescription string) (string, error) {
+func (c *googlePlayMusicClient) createNewPlaylist(playlist Playlist) (string, error) {
+	shareState := models.GPM_PLAYLIST_SHARESTATE_PRIVATE
+	if playlist.Public() {
+		shareState = models.GPM_PLAYLIST_SHARESTATE_PUBLIC
+	}
 	request := &models.GpmCreatePlaylistRequestMutations{Mutations: []models.GpmCreatePlaylistRequest{
 		{GpmCreatePlaylist: models.GpmCreatePlaylist{
-			Name:                  playlistName,
-			Description:           playListDescription,
+			Name:                  playlist.Name,
+			Description:           playlist.Description,
 			Deleted:               false,
 			CreationTimestamp:     "-1",
 			LastModifiedTimestamp: "0",
 			PlaylistType:          models.GPM_PLAYLIST_TYPE,
-			ShareState:            models.GPM_PLAYLIST_SHARESTATE_PUBLIC}}}}
+			ShareState:            shareState}}}}
 	jsonRequest, err := json.Marshal(request)
 	if err != nil {
 		return "", fmt.Errorf("failed to create json request [err=%v]", err)
 	}
 	response, err := c.makeRequest(http.MethodPost, PATH_GPM_CREATE_PLAYLIST, bytes.NewReader(jsonRequest))
 	if err != nil {
-		return "", fmt.Errorf("failed to create playlist [name=%s][err=%v]", playlistName, err)
+		return "", fmt.Errorf("failed to create playlist [name=%s][err=%v]", playlist.Name, err)
 	}
 	dec := json.NewDecoder(strings.NewReader(response))
 	var responseObj models.GpmCreatePlaylistMutationsResponse
@@ -105,54 +499,30 @@ func (c *googlePlayMusicClient) createNewPlaylist(playlistName, playListDescript
 	if err != nil {
 		return "", fmt.Errorf("failed to parse response [response=%s][err=%v]", response, err)
 	}
-	return responseObj.Response[0].Id, nil
+	if len(responseObj.Response) == 0 {
+		return "", fmt.Errorf("failed to create playlist, empty response [name=%v][response=%s]", playlist.Name, response)
+	}
+	created := responseObj.Response[0]
+	if created.ResponseCode != "OK" || len(created.Id) == 0 {
+		return "", fmt.Errorf("failed to create playlist [name=%v][responsecode=%s]", playlist.Name, created.ResponseCode)
+	}
+	return created.Id, nil
 }
 
-func (c *googlePlayMusicClient) addTracksToPlaylist(id string, songs []Song) error {
-	var errorList []error
-	var tracks []models.GpmSearchItem
-	//TODO Make concurrent
-	for _, song := range songs {
-		track, err := c.findBestMatchSong(song)
-		if err != nil {
-			errorList = append(errorList, err)
-		} else {
-			tracks = append(tracks, *track)
-		}
-	}
-	if len(tracks) > 0 {
-		var addTrackEntries []models.GpmCreateSongEntry
-		prevId := ""
-		currId := uuid.NewUUID().String()
-		nextId := uuid.NewUUID().String()
-		for i, track := range tracks {
-			log.Printf("Adding Track %s\n", track.Track.Name)
-			source := 1
-			if strings.HasPrefix(track.Track.Id, "T") {
-				source = 2
-			}
-			entry := models.GpmCreateSongEntry{CreateGpmSongEntry: models.GpmSongEntry{
-				CreationTimestamp:     "-1",
-				Deleted:               false,
-				LastModifiedTimestamp: "0",
-				PlayListId:            id,
-				SongId:                track.Track.Id,
-				Source:                source,
-				ClientId:              currId}}
-
-			if i > 0 {
-				entry.CreateGpmSongEntry.PreviousEntryId = prevId
-			}
-			if i < len(tracks)-1 {
-				entry.CreateGpmSongEntry.NextEntryId = nextId
-			}
-
-			addTrackEntries = append(addTrackEntries, entry)
-
-			prevId = currId
-			currId = nextId
-			nextId = uuid.NewUUID().String()
+// addTracksToPlaylist matches songs and adds the matched tracks, unless this is a dry run.
+func (c *googlePlayMusicClient) addTracksToPlaylist(id string, songs []Song) ([]TrackMatch, error) {
+	matches := c.resolver.resolveAll(songs)
+	indexes, errorList := matchedTracks(matches)
+	if c.dryRun {
+		return matches, nil
+	}
+	if len(indexes) > 0 {
+		var tracks []Song
+		for _, index := range indexes {
+			log.Printf("Adding Track %s\n", matches[index].Source.Name)
+			tracks = append(tracks, *matches[index].Track)
 		}
+		addTrackEntries := gpmPlaylistEntries(id, tracks, c.newEntryId)
 		addTracksRequest := models.GpmCreateSongEntryMutations{Mutations: addTrackEntries}
 		jsonRequest, err := json.Marshal(addTracksRequest)
 		if err != nil {
@@ -160,66 +530,132 @@ func (c *googlePlayMusicClient) addTracksToPlaylist(id string, songs []Song) err
 		} else {
 			response, err := c.makeRequest(http.MethodPost, PATH_GPM_ADD_SONGS_TO_PLAYLIST, bytes.NewReader(jsonRequest))
 			if err != nil {
-				errorList = append(errorList, fmt.Errorf("failed to add songs to playlist [id=%s][err=%v]", id, err))
-			}
-			dec := json.NewDecoder(strings.NewReader(response))
-			var responseObj models.GpmAddTracksMutationsResponse
-			err = dec.Decode(&responseObj)
-			if err != nil {
-				errorList = append(errorList, fmt.Errorf("failed to parse response [response=%s][err=%v]", response, err))
-			}
-			for _, responseEntry := range responseObj.Response {
-				if responseEntry.ResponseCode != "OK" {
-					errorList = append(errorList, fmt.Errorf("failed to add track [id=%s][err=%v]", responseEntry.Id, err))
+				err = fmt.Errorf("failed to add songs to playlist [id=%s][err=%w]", id, err)
+				for _, index := range indexes {
+					errorList = append(errorList, failMatch(&matches[index], failureReason(err), err))
+				}
+			} else {
+				dec := json.NewDecoder(strings.NewReader(response))
+				var responseObj models.GpmAddTracksMutationsResponse
+				err = dec.Decode(&responseObj)
+				if err != nil {
+					errorList = append(errorList, fmt.Errorf("failed to parse response [response=%s][err=%v]", response, err))
+				}
+				for i, responseEntry := range responseObj.Response {
+					if responseEntry.ResponseCode != "OK" {
+						entryErr := fmt.Errorf("failed to add track [id=%s][responsecode=%s]", responseEntry.Id, responseEntry.ResponseCode)
+						if i < len(indexes) {
+							entryErr = failMatch(&matches[indexes[i]], REASON_REJECTED, entryErr)
+						}
+						errorList = append(errorList, entryErr)
+					}
 				}
 			}
 		}
 	}
 	if len(errorList) == 0 {
-		return nil
+		return matches, nil
 	} else {
-		return flattenErrors(errorList)
+		return matches, newMultiError(errorList)
 	}
 }
 
+// gpmPlaylistEntries links the new entries of tracks into a list: each entry names the client
+// ids of the entries before and after it, which newId generates.
+func gpmPlaylistEntries(playlistId string, tracks []Song, newId func() string) []models.GpmCreateSongEntry {
+	var entries []models.GpmCreateSongEntry
+	prevId := ""
+	currId := newId()
+	nextId := newId()
+	for i, track := range tracks {
+		source := 1
+		if strings.HasPrefix(track.Id, "T") {
+			source = 2
+		}
+		entry := models.GpmCreateSongEntry{CreateGpmSongEntry: models.GpmSongEntry{
+			CreationTimestamp:     "-1",
+			Deleted:               false,
+			LastModifiedTimestamp: "0",
+			PlayListId:            playlistId,
+			SongId:                track.Id,
+			Source:                source,
+			ClientId:              currId}}
+
+		if i > 0 {
+			entry.CreateGpmSongEntry.PreviousEntryId = prevId
+		}
+		if i < len(tracks)-1 {
+			entry.CreateGpmSongEntry.NextEntryId = nextId
+		}
+
+		entries = append(entries, entry)
+
+		prevId = currId
+		currId = nextId
+		nextId = newId()
+	}
+	return entries
+}
+
 func (c *googlePlayMusicClient) makeRequest(method, path string, body io.Reader) (string, error) {
-	req, err := http.NewRequest(method, fmt.Sprintf("%s%s", BASE_GPM_URI, path), body)
+	var requestBody []byte
+	if body != nil {
+		var err error
+		requestBody, err = ioutil.ReadAll(body)
+		if err != nil {
+			return "", fmt.Errorf("failed to create http request for [path=%s][err=%v]", path, err)
+		}
+	}
+	requestUrl, err := url.Parse(fmt.Sprintf("%s%s", c.baseUrl, path))
 	if err != nil {
 		return "", fmt.Errorf("failed to create http request for [path=%s][err=%v]", path, err)
 	}
-	q := req.URL.Query()
+	q := requestUrl.Query()
 	q.Add("tier", "aa")
 	q.Add("hl", "en_US")
 	q.Add("dv", "0")
 	q.Add("alt", "json")
-	req.URL.RawQuery = q.Encode()
-	req.Header.Add("Authorization", fmt.Sprintf("GoogleLogin auth=%s", c.oAuthToken))
-	req.Header.Add("Content-type", "application/json")
-	response, err := c.client.Do(req)
-	if err != nil {
-		return "", fmt.Errorf("failed to create http request for [path=%s][err=%v]", path, err)
+	requestUrl.RawQuery = q.Encode()
+	header := http.Header{}
+	header.Add("Authorization", fmt.Sprintf("GoogleLogin auth=%s", c.oAuthToken))
+	header.Add("Content-type", "application/json")
+	return c.transport.do(method, requestUrl.String(), path, requestBody, header, idempotentMethod(method) || gpmReadPaths[path])
+}
+
+func (c *googlePlayMusicClient) searchQueries(song Song) []string {
+	if len(song.Artists) == 0 {
+		return []string{song.Name}
+	} else {
+		return []string{fmt.Sprintf("%s - %s", song.Artists[0].Name, song.Name), song.Name}
 	}
-	result, err := ioutil.ReadAll(response.Body)
-	defer response.Body.Close()
+}
+
+func (c *googlePlayMusicClient) searchTracks(searchQuery string) ([]Song, error) {
+	responseObj, err := c.search(searchQuery, GPM_TYPE_TRACK)
 	if err != nil {
-		return "", fmt.Errorf("failed to create http request for [path=%s][err=%v]", path, err)
+		return nil, err
 	}
-	if response.StatusCode == http.StatusOK {
-		return string(result), nil
-	} else {
-		return "", fmt.Errorf("failed to make http request for [path=%s][httpstatus=%d][err=%s]", path, response.StatusCode, string(result))
+	var songs []Song
+	for _, track := range responseObj.Entries {
+		if track.ItemType == GPM_TYPE_TRACK {
+			songs = append(songs, gpmMediaSong(track.Track))
+		}
 	}
+	return songs, nil
 }
-func (c *googlePlayMusicClient) findBestMatchSong(song Song) (*models.GpmSearchItem, error) {
-	seachQuery := c.searchQuery(song)
+
+// search queries the catalog for items of contentType, searching again with the query Google
+// suggests when there is one.
+func (c *googlePlayMusicClient) search(searchQuery, contentType string) (*models.GpmSearchResponse, error) {
+	suggested := false
 	for {
 		query := url.Values{}
-		query.Add("q", seachQuery)
+		query.Add("q", searchQuery)
 		query.Add("max-results", MAX_GPM_SEARCH_RESULTS)
-		query.Add("ct", "1")
+		query.Add("ct", contentType)
 		response, err := c.makeRequest(http.MethodGet, fmt.Sprintf("%s?%s", PATH_GPM_SEARCH, query.Encode()), nil)
 		if err != nil {
-			return nil, fmt.Errorf("failed to search request [song=%s][err=%v]", song.Name, err)
+			return nil, err
 		}
 		dec := json.NewDecoder(strings.NewReader(response))
 		var responseObj models.GpmSearchResponse
@@ -227,32 +663,46 @@ func (c *googlePlayMusicClient) findBestMatchSong(song Song) (*models.GpmSearchI
 		if err != nil {
 			return nil, fmt.Errorf("failed to parse response [response=%s][err=%v]", response, err)
 		}
-		if len(responseObj.SuggestedQuery) != 0 {
-			seachQuery = responseObj.SuggestedQuery
+		if len(responseObj.SuggestedQuery) != 0 && !suggested {
+			searchQuery = responseObj.SuggestedQuery
+			suggested = true
 			continue
 		}
-		for _, track := range responseObj.Entries {
-			if track.ItemType == "1" {
-				return &track, nil
-			}
-		}
-		return nil, fmt.Errorf("failed to find a match [song=%s][err=%v]", song.Name, err)
+		return &responseObj, nil
 	}
-
 }
 
-func (c *googlePlayMusicClient) searchQuery(song Song) string {
-	if len(song.Artists) == 0 {
-		return song.Name
-	} else {
-		return fmt.Sprintf("%s - %s", song.Artists[0].Name, song.Name)
+func gpmMediaSong(track models.TrackItem) Song {
+	var artists []Artist
+	if len(track.Artist) > 0 {
+		artist := Artist{Name: track.Artist}
+		if len(track.ArtistId) > 0 {
+			artist.Id = track.ArtistId[0]
+		}
+		artists = append(artists, artist)
+	}
+	id := track.Id
+	if len(id) == 0 {
+		id = track.LibraryId
 	}
+	durationMillis, _ := strconv.ParseInt(track.DurationMillis, 10, 64)
+	return Song{
+		Name:        track.Name,
+		Album:       gpmTrackAlbum(track),
+		Artists:     artists,
+		Id:          id,
+		Duration:    time.Duration(durationMillis) * time.Millisecond,
+		DiscNumber:  track.DiscNumber,
+		TrackNumber: track.TrackNumber,
+		Explicit:    track.ExplicitType == models.GPM_EXPLICIT_TYPE_EXPLICIT,
+		Year:        track.Year,
+		ServiceIds:  serviceIds(SERVICE_GOOGLE_PLAY_MUSIC, id, "")}
 }
 
-func flattenErrors(errorList []error) error {
-	var err error = nil
-	for _, errorVal := range errorList {
-		err = errors.New(fmt.Sprintf("\n[err=%v]", errorVal))
+func gpmTrackAlbum(track models.TrackItem) Album {
+	album := Album{Name: track.Album, Id: track.AlbumId}
+	if len(track.AlbumArtist) > 0 {
+		album.Artists = []Artist{{Name: track.AlbumArtist}}
 	}
-	return err
+	return album
 }
@@ -0,0 +1,251 @@
+package musicserviceclients
+
+import (
+	"fmt"
+	"musicserviceclients/fakes"
+	"musicserviceclients/models"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGpmPlaylistEntries(t *testing.T) {
+	tests := []struct {
+		name   string
+		tracks []Song
+	}{
+		{"empty", nil},
+		{"single", []Song{{Name: "Mr. Brightside", Id: "Tj6fhurtstzgdpvfm4xv6i5cei4"}}},
+		{"two", []Song{{Name: "Mr. Brightside", Id: "Tj6fhurtstzgdpvfm4xv6i5cei4"}, {Name: "Take On Me", Id: "6a1e2f4c-0d3b-4e5a-9b7c-8d9e0f1a2b3c"}}},
+		{"mixed_sources", []Song{
+			{Name: "Mr. Brightside", Id: "Tj6fhurtstzgdpvfm4xv6i5cei4"},
+			{Name: "Take On Me", Id: "6a1e2f4c-0d3b-4e5a-9b7c-8d9e0f1a2b3c"},
+			{Name: "Dreams", Id: "Tmqmu4psvbiy4rd5xbdz5cfvkqe"},
+			{Name: "Dreams", Id: "Tmqmu4psvbiy4rd5xbdz5cfvkqe"}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			entries := gpmPlaylistEntries("a3c5a9f2-1d2e-4d4b-9a61-2f0e5b7c8d90", test.tracks, sequentialIds())
+			assertGolden(t, fmt.Sprintf("gpm/entries_%s.golden.json", test.name), entries)
+			assertLinked(t, entries)
+		})
+	}
+}
+
+// assertLinked checks that the entries form a list in which every entry points at its
+// neighbours.
+func assertLinked(t *testing.T, entries []models.GpmCreateSongEntry) {
+	t.Helper()
+	seen := make(map[string]bool)
+	for i, entry := range entries {
+		song := entry.CreateGpmSongEntry
+		if seen[song.ClientId] {
+			t.Errorf("entry %d reuses client id %s", i, song.ClientId)
+		}
+		seen[song.ClientId] = true
+		previous, next := "", ""
+		if i > 0 {
+			previous = entries[i-1].CreateGpmSongEntry.ClientId
+		}
+		if i < len(entries)-1 {
+			next = entries[i+1].CreateGpmSongEntry.ClientId
+		}
+		if song.PreviousEntryId != previous || song.NextEntryId != next {
+			t.Errorf("entry %d links to [previous=%s][next=%s], want [previous=%s][next=%s]", i, song.PreviousEntryId, song.NextEntryId, previous, next)
+		}
+	}
+}
+
+func sequentialIds() func() string {
+	count := 0
+	return func() string {
+		count++
+		return fmt.Sprintf("client-%d", count)
+	}
+}
+
+func TestGpmMediaSong(t *testing.T) {
+	tests := []struct {
+		name     string
+		track    models.TrackItem
+		expected Song
+	}{
+		{"store track",
+			models.TrackItem{Name: "Dreams", Artist: "Fleetwood Mac", ArtistId: []string{"Aqrbxw6ne3f2tx7j5fqgj7ex3fe"}, Album: "Rumours", AlbumArtist: "Fleetwood Mac", AlbumId: "Bu6xbdtbfcwh6qfvvzx2ysxeqeu",
+				Id: "Tmqmu4psvbiy4rd5xbdz5cfvkqe", LibraryId: "7b2f3a5d", DurationMillis: "257000", DiscNumber: 1, TrackNumber: 2, Year: 1977, ExplicitType: "2"},
+			Song{Name: "Dreams", Album: Album{Name: "Rumours", Id: "Bu6xbdtbfcwh6qfvvzx2ysxeqeu", Artists: []Artist{{Name: "Fleetwood Mac"}}}, Artists: []Artist{{Name: "Fleetwood Mac", Id: "Aqrbxw6ne3f2tx7j5fqgj7ex3fe"}},
+				Id: "Tmqmu4psvbiy4rd5xbdz5cfvkqe", Duration: 257 * time.Second, DiscNumber: 1, TrackNumber: 2, Year: 1977,
+				ServiceIds: map[string]ServiceId{SERVICE_GOOGLE_PLAY_MUSIC: {Id: "Tmqmu4psvbiy4rd5xbdz5cfvkqe"}}}},
+		{"explicit track",
+			models.TrackItem{Name: "Lose Yourself", Artist: "Eminem", Album: "8 Mile", Id: "Tkqm4pcqhq6nujqxogfrpgt3ttm", DurationMillis: "326000", ExplicitType: models.GPM_EXPLICIT_TYPE_EXPLICIT},
+			Song{Name: "Lose Yourself", Album: Album{Name: "8 Mile"}, Artists: []Artist{{Name: "Eminem"}}, Id: "Tkqm4pcqhq6nujqxogfrpgt3ttm", Duration: 326 * time.Second, Explicit: true,
+				ServiceIds: map[string]ServiceId{SERVICE_GOOGLE_PLAY_MUSIC: {Id: "Tkqm4pcqhq6nujqxogfrpgt3ttm"}}}},
+		{"uploaded track",
+			models.TrackItem{Name: "Take On Me", Artist: "a-ha", Album: "Hunting High and Low", LibraryId: "6a1e2f4c", DurationMillis: "225000"},
+			Song{Name: "Take On Me", Album: Album{Name: "Hunting High and Low"}, Artists: []Artist{{Name: "a-ha"}}, Id: "6a1e2f4c", Duration: 225 * time.Second,
+				ServiceIds: map[string]ServiceId{SERVICE_GOOGLE_PLAY_MUSIC: {Id: "6a1e2f4c"}}}},
+		{"no artist or duration",
+			models.TrackItem{Name: "Untitled", LibraryId: "8c3a4b6e", DurationMillis: "unknown"},
+			Song{Name: "Untitled", Id: "8c3a4b6e", ServiceIds: map[string]ServiceId{SERVICE_GOOGLE_PLAY_MUSIC: {Id: "8c3a4b6e"}}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actual := gpmMediaSong(test.track)
+			if !reflect.DeepEqual(actual, test.expected) {
+				t.Errorf("gpmMediaSong() = %+v, want %+v", actual, test.expected)
+			}
+		})
+	}
+}
+
+func TestGpmMediaPlaylist(t *testing.T) {
+	tests := []struct {
+		name       string
+		playlist   models.GpmPlaylist
+		visibility Visibility
+		cover      string
+	}{
+		{"public", models.GpmPlaylist{ShareState: models.GPM_PLAYLIST_SHARESTATE_PUBLIC}, VISIBILITY_PUBLIC, ""},
+		{"private", models.GpmPlaylist{ShareState: models.GPM_PLAYLIST_SHARESTATE_PRIVATE}, VISIBILITY_PRIVATE, ""},
+		{"unknown share state", models.GpmPlaylist{ShareState: "LINK"}, "", ""},
+		{"album art", models.GpmPlaylist{AlbumArtRef: []models.GpmArtRef{{Url: "https://lh3.googleusercontent.com/first"}, {Url: "https://lh3.googleusercontent.com/second"}}},
+			"", "https://lh3.googleusercontent.com/first"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			playlist := gpmMediaPlaylist(test.playlist, nil)
+			if playlist.Visibility != test.visibility || playlist.CoverImageUrl != test.cover {
+				t.Errorf("gpmMediaPlaylist() = [visibility=%s][cover=%s], want [visibility=%s][cover=%s]", playlist.Visibility, playlist.CoverImageUrl, test.visibility, test.cover)
+			}
+		})
+	}
+}
+
+func TestGpmPositionLess(t *testing.T) {
+	tests := []struct {
+		name      string
+		positions []string
+		expected  []string
+	}{
+		{"zero padded", []string{"01729382256910287871", "00000000000000000000", "00576460752303423487"},
+			[]string{"00000000000000000000", "00576460752303423487", "01729382256910287871"}},
+		{"different widths", []string{"1000", "999", "20"}, []string{"20", "999", "1000"}},
+		{"unparsable last", []string{"b", "10", "", "2", "a"}, []string{"2", "10", "", "a", "b"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			positions := append([]string(nil), test.positions...)
+			sort.SliceStable(positions, func(i, j int) bool {
+				return gpmPositionLess(positions[i], positions[j])
+			})
+			if !reflect.DeepEqual(positions, test.expected) {
+				t.Errorf("sorted positions %v, want %v", positions, test.expected)
+			}
+		})
+	}
+}
+
+func TestGpmCreateNewPlaylistResponse(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		id       string
+		err      string
+	}{
+		{"created", `{"mutate_response":[{"id":"created","response_code":"OK"}]}`, "created", ""},
+		{"empty response", `{"mutate_response":[]}`, "", "empty response [name=Road Trip]"},
+		{"rejected", `{"mutate_response":[{"response_code":"INVALID_REQUEST"}]}`, "", "[name=Road Trip][responsecode=INVALID_REQUEST]"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := fakes.NewServer([]fakes.Fixture{{Method: http.MethodPost, Path: "/sj/v2.5/playlistbatch", Response: []byte(test.response)}})
+			defer server.Close()
+			client, err := NewGooglePlayMusicClient(ServiceConfig{Gpm: GpmConfig{BaseUrl: server.GpmBaseUrl()}, RetryPolicy: RetryPolicy{MaxRetries: -1}})
+			if err != nil {
+				t.Fatalf("failed to create client [err=%v]", err)
+			}
+
+			id, err := client.(*googlePlayMusicClient).createNewPlaylist(Playlist{Name: "Road Trip"})
+			if len(test.err) == 0 && err != nil {
+				t.Fatalf("createNewPlaylist() failed [err=%v]", err)
+			}
+			if len(test.err) > 0 && (err == nil || !strings.Contains(err.Error(), test.err)) {
+				t.Errorf("createNewPlaylist() returned [err=%v], want an error containing %s", err, test.err)
+			}
+			if id != test.id {
+				t.Errorf("createNewPlaylist() returned id %q, want %q", id, test.id)
+			}
+		})
+	}
+}
+
+func TestGpmSaveTracksUpdatesLibrary(t *testing.T) {
+	server, err := fakes.NewGpmServer()
+	if err != nil {
+		t.Fatalf("failed to start gpm server [err=%v]", err)
+	}
+	defer server.Close()
+	client, err := NewGooglePlayMusicClient(ServiceConfig{
+		Gpm:          GpmConfig{BaseUrl: server.GpmBaseUrl()},
+		TrackMapping: fakeMapping{"dreams": "Tmqmu4psvbiy4rd5xbdz5cfvkqe", "brightside": "Tj6fhurtstzgdpvfm4xv6i5cei4"},
+		RetryPolicy:  RetryPolicy{MaxRetries: -1}})
+	if err != nil {
+		t.Fatalf("failed to create client [err=%v]", err)
+	}
+	songs := []Song{{Name: "Dreams", Id: "dreams"}, {Name: "Mr. Brightside", Id: "brightside"}}
+
+	for run := 0; run < 2; run++ {
+		_, err = client.SaveTracks(songs)
+		if err != nil {
+			t.Fatalf("SaveTracks() failed [run=%d][err=%v]", run, err)
+		}
+	}
+	saved, err := client.ListSavedTracks()
+	if err != nil {
+		t.Fatalf("ListSavedTracks() failed [err=%v]", err)
+	}
+
+	counts := make(map[string]int)
+	for _, request := range server.Requests() {
+		counts[request.Path]++
+	}
+	if counts["/sj/v2.5/trackfeed"] != 1 || counts["/sj/v2.5/trackbatch"] != 1 {
+		t.Errorf("listed the library %d times and saved %d batches, want 1 and 1", counts["/sj/v2.5/trackfeed"], counts["/sj/v2.5/trackbatch"])
+	}
+	var names []string
+	for _, song := range saved {
+		names = append(names, song.Name)
+	}
+	sort.Strings(names)
+	if expected := []string{"Dreams", "Mr. Brightside", "Take On Me"}; !reflect.DeepEqual(names, expected) {
+		t.Errorf("ListSavedTracks() = %v, want %v", names, expected)
+	}
+}
+
+func TestGpmRemoveTracksLastOccurrence(t *testing.T) {
+	server := fakes.NewServer([]fakes.Fixture{
+		{Method: http.MethodPost, Path: "/sj/v2.5/plentryfeed", Response: []byte(`{"data":{"items":[` +
+			`{"id":"e1","playlistId":"mix","trackId":"a","absolutePosition":"1"},` +
+			`{"id":"e2","playlistId":"mix","trackId":"b","absolutePosition":"2"},` +
+			`{"id":"e3","playlistId":"mix","trackId":"a","absolutePosition":"3"},` +
+			`{"id":"e4","playlistId":"other","trackId":"a","absolutePosition":"4"}]}}`)},
+		{Method: http.MethodPost, Path: "/sj/v2.5/plentriesbatch",
+			Request:  []byte(`{"mutations":[{"delete":"e3"}]}`),
+			Response: []byte(`{"mutate_response":[{"id":"e3","response_code":"OK"}]}`)}})
+	defer server.Close()
+	client, err := NewGooglePlayMusicClient(ServiceConfig{Gpm: GpmConfig{BaseUrl: server.GpmBaseUrl()}, RetryPolicy: RetryPolicy{MaxRetries: -1}})
+	if err != nil {
+		t.Fatalf("failed to create client [err=%v]", err)
+	}
+
+	err = client.RemoveTracks("mix", []Song{{Name: "A", Id: "a"}})
+	if err != nil {
+		t.Fatalf("RemoveTracks() failed [err=%v]", err)
+	}
+	for _, request := range server.Unmatched() {
+		t.Errorf("unexpected request [method=%s][path=%s][body=%s]", request.Method, request.Path, request.Body)
+	}
+}
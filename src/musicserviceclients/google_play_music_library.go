@@ -0,0 +1,319 @@
+package musicserviceclients
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"musicserviceclients/models"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+func (c *googlePlayMusicClient) ListSavedTracks() ([]Song, error) {
+	libraryTracks, err := c.cachedLibraryTracks()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list library tracks [err=%v]", err)
+	}
+	var songs []Song
+	for _, track := range libraryTracks {
+		if !track.Deleted {
+			songs = append(songs, gpmMediaSong(track))
+		}
+	}
+	sort.SliceStable(songs, func(i, j int) bool {
+		return SongKey(songs[i]) < SongKey(songs[j])
+	})
+	return songs, nil
+}
+
+// ListSavedAlbums returns the albums of the library tracks, as Google Play Music has no saved
+// albums of its own.
+func (c *googlePlayMusicClient) ListSavedAlbums() ([]Album, error) {
+	libraryTracks, err := c.cachedLibraryTracks()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list library tracks [err=%v]", err)
+	}
+	seen := make(map[string]bool)
+	var albums []Album
+	for _, track := range libraryTracks {
+		if track.Deleted || len(track.Album) == 0 {
+			continue
+		}
+		artist := track.AlbumArtist
+		if len(artist) == 0 {
+			artist = track.Artist
+		}
+		key := track.AlbumId
+		if len(key) == 0 {
+			key = strings.ToLower(artist + " - " + track.Album)
+		}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		album := Album{Name: track.Album, Id: track.AlbumId}
+		if len(artist) > 0 {
+			album.Artists = []Artist{{Name: artist}}
+		}
+		albums = append(albums, album)
+	}
+	sort.SliceStable(albums, func(i, j int) bool {
+		return strings.ToLower(albums[i].Name) < strings.ToLower(albums[j].Name)
+	})
+	return albums, nil
+}
+
+func (c *googlePlayMusicClient) ListFollowedArtists() ([]Artist, error) {
+	return nil, fmt.Errorf("failed to list followed artists [service=%s][err=%w]", SERVICE_GOOGLE_PLAY_MUSIC, errors.ErrUnsupported)
+}
+
+// SaveTracks matches songs and adds the matched store tracks to the library, unless this is a
+// dry run. Tracks already in the library are not added again.
+func (c *googlePlayMusicClient) SaveTracks(songs []Song) ([]TrackMatch, error) {
+	matches := c.resolver.resolveAll(songs)
+	indexes, errorList := matchedTracks(matches)
+	if c.dryRun {
+		return matches, nil
+	}
+	libraryTracks, err := c.cachedLibraryTracks()
+	if err != nil {
+		return matches, fmt.Errorf("failed to list library tracks [err=%v]", err)
+	}
+	saved := make(map[string]bool)
+	for _, track := range libraryTracks {
+		if !track.Deleted {
+			saved[track.Id] = true
+			saved[track.LibraryId] = true
+		}
+	}
+	var ids []string
+	var adding []int
+	for _, i := range indexes {
+		if saved[matches[i].Track.Id] {
+			continue
+		}
+		log.Printf("Saving Track %s\n", matches[i].Source.Name)
+		ids = append(ids, matches[i].Track.Id)
+		adding = append(adding, i)
+	}
+	for i, err := range c.addLibraryTracks(ids) {
+		if err != nil {
+			errorList = append(errorList, failMatch(&matches[adding[i]], failureReason(err), err))
+		}
+	}
+	if len(errorList) == 0 {
+		return matches, nil
+	} else {
+		return matches, newMultiError(errorList)
+	}
+}
+
+// SaveAlbums matches albums and adds all of their tracks to the library, unless this is a dry
+// run.
+func (c *googlePlayMusicClient) SaveAlbums(albums []Album) ([]Album, error) {
+	resolved, errorList := c.resolver.resolveAlbums(c, albums)
+	if c.dryRun {
+		return resolved, newMultiError(errorList)
+	}
+	var saved []Album
+	for _, album := range resolved {
+		gpmAlbum, err := c.getAlbum(album.Id)
+		if err != nil {
+			errorList = append(errorList, err)
+			continue
+		}
+		log.Printf("Saving Album %s\n", album.Name)
+		var ids []string
+		for _, track := range gpmAlbum.Tracks {
+			if len(track.Id) > 0 {
+				ids = append(ids, track.Id)
+			} else {
+				ids = append(ids, track.Nid)
+			}
+		}
+		failed := false
+		for _, err := range c.addLibraryTracks(ids) {
+			if err != nil {
+				errorList = append(errorList, fmt.Errorf("failed to save album [album=%s][err=%w]", album.Name, err))
+				failed = true
+			}
+		}
+		if !failed {
+			saved = append(saved, album)
+		}
+	}
+	return saved, newMultiError(errorList)
+}
+
+func (c *googlePlayMusicClient) FollowArtists(artists []Artist) ([]Artist, error) {
+	return nil, fmt.Errorf("failed to follow artists [service=%s][err=%w]", SERVICE_GOOGLE_PLAY_MUSIC, errors.ErrUnsupported)
+}
+
+func (c *googlePlayMusicClient) cachedLibraryTracks() (map[string]models.TrackItem, error) {
+	if c.libraryTracks == nil {
+		libraryTracks, err := c.getLibraryTracks()
+		if err != nil {
+			return nil, err
+		}
+		c.libraryTracks = libraryTracks
+	}
+	return c.libraryTracks, nil
+}
+
+// cacheLibraryTrack adds a track saved to the library to the cached library tracks, when they
+// were listed already, so that later saves of the same run skip it. The cache is dropped when
+// the track cannot be read back.
+func (c *googlePlayMusicClient) cacheLibraryTrack(track map[string]interface{}, libraryId string) {
+	if c.libraryTracks == nil {
+		return
+	}
+	var item models.TrackItem
+	content, err := json.Marshal(track)
+	if err == nil {
+		err = json.Unmarshal(content, &item)
+	}
+	if err != nil || len(libraryId) == 0 {
+		c.libraryTracks = nil
+		return
+	}
+	item.LibraryId = libraryId
+	c.libraryTracks[libraryId] = item
+}
+
+// addLibraryTracks adds store tracks to the library and returns the error of each of them, nil
+// for the ones that were added.
+func (c *googlePlayMusicClient) addLibraryTracks(storeIds []string) []error {
+	errorList := make([]error, len(storeIds))
+	if len(storeIds) == 0 {
+		return errorList
+	}
+	var mutations []models.GpmTrackMutation
+	var mutated []int
+	for i, storeId := range storeIds {
+		track, err := c.fetchStoreTrack(storeId)
+		if err != nil {
+			errorList[i] = err
+			continue
+		}
+		mutations = append(mutations, models.GpmTrackMutation{Create: libraryTrack(track)})
+		mutated = append(mutated, i)
+	}
+	if len(mutations) == 0 {
+		return errorList
+	}
+	jsonRequest, err := json.Marshal(models.GpmTrackMutations{Mutations: mutations})
+	if err != nil {
+		err = fmt.Errorf("failed to create json request [err=%v]", err)
+	} else {
+		var response string
+		response, err = c.makeRequest(http.MethodPost, PATH_GPM_TRACK_BATCH, bytes.NewReader(jsonRequest))
+		if err != nil {
+			err = fmt.Errorf("failed to add tracks to library [err=%w]", err)
+		} else {
+			dec := json.NewDecoder(strings.NewReader(response))
+			var responseObj models.GpmAddTracksMutationsResponse
+			err = dec.Decode(&responseObj)
+			if err != nil {
+				err = fmt.Errorf("failed to parse response [response=%s][err=%v]", response, err)
+			}
+			for i, responseEntry := range responseObj.Response {
+				if i >= len(mutated) {
+					break
+				}
+				if responseEntry.ResponseCode != "OK" {
+					errorList[mutated[i]] = fmt.Errorf("failed to add track to library [id=%s][responsecode=%s]", storeIds[mutated[i]], responseEntry.ResponseCode)
+				} else {
+					c.cacheLibraryTrack(mutations[i].Create, responseEntry.Id)
+				}
+			}
+		}
+	}
+	if err != nil {
+		for _, i := range mutated {
+			errorList[i] = err
+		}
+	}
+	return errorList
+}
+
+func (c *googlePlayMusicClient) fetchStoreTrack(storeId string) (map[string]interface{}, error) {
+	response, err := c.makeRequest(http.MethodGet, fmt.Sprintf(PATH_GPM_FETCH_TRACK, url.QueryEscape(storeId)), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch track [id=%s][err=%w]", storeId, err)
+	}
+	var track map[string]interface{}
+	err = json.Unmarshal([]byte(response), &track)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse response [response=%s][err=%v]", response, err)
+	}
+	return track, nil
+}
+
+// libraryTrack turns a store track into a library track, dropping the store only fields.
+func libraryTrack(track map[string]interface{}) map[string]interface{} {
+	for _, key := range []string{"kind", "trackAvailableForPurchase", "albumAvailableForPurchase", "albumArtRef", "artistId"} {
+		delete(track, key)
+	}
+	defaults := map[string]interface{}{
+		"playCount":             0,
+		"rating":                "0",
+		"genre":                 "",
+		"lastModifiedTimestamp": "0",
+		"deleted":               false,
+		"beatsPerMinute":        -1,
+		"composer":              "",
+		"creationTimestamp":     "-1",
+		"totalDiscCount":        0,
+	}
+	for key, value := range defaults {
+		if _, ok := track[key]; !ok {
+			track[key] = value
+		}
+	}
+	track["trackType"] = 8
+	return track
+}
+
+func (c *googlePlayMusicClient) getAlbum(albumId string) (*models.GpmAlbum, error) {
+	response, err := c.makeRequest(http.MethodGet, fmt.Sprintf(PATH_GPM_FETCH_ALBUM, url.QueryEscape(albumId)), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch album [id=%s][err=%w]", albumId, err)
+	}
+	dec := json.NewDecoder(strings.NewReader(response))
+	var album models.GpmAlbum
+	err = dec.Decode(&album)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse response [response=%s][err=%v]", response, err)
+	}
+	return &album, nil
+}
+
+func (c *googlePlayMusicClient) searchAlbums(album Album) ([]Album, error) {
+	searchQuery := album.Name
+	if len(album.Artists) > 0 {
+		searchQuery = fmt.Sprintf("%s - %s", album.Artists[0].Name, album.Name)
+	}
+	responseObj, err := c.search(searchQuery, GPM_TYPE_ALBUM)
+	if err != nil {
+		return nil, err
+	}
+	var albums []Album
+	for _, entry := range responseObj.Entries {
+		if entry.ItemType == GPM_TYPE_ALBUM {
+			albums = append(albums, gpmMediaAlbum(entry.Album))
+		}
+	}
+	return albums, nil
+}
+
+func gpmMediaAlbum(album models.GpmAlbum) Album {
+	var artists []Artist
+	if len(album.AlbumArtist) > 0 {
+		artists = append(artists, Artist{Name: album.AlbumArtist})
+	}
+	return Album{Name: album.Name, Id: album.AlbumId, Artists: artists}
+}
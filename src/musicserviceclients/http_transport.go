@@ -0,0 +1,187 @@
+package musicserviceclients
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DEFAULT_MAX_RETRIES     = 5
+	DEFAULT_INITIAL_BACKOFF = 500 * time.Millisecond
+	DEFAULT_MAX_BACKOFF     = 30 * time.Second
+)
+
+// RetryPolicy bounds how often and how long a failed request is retried. Zero values fall back
+// to the defaults, a negative MaxRetries disables retries.
+type RetryPolicy struct {
+	MaxRetries     int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+// HttpError is returned for responses that are not successful after all retries.
+type HttpError struct {
+	Service    string
+	Path       string
+	StatusCode int
+	Body       string
+}
+
+func (e *HttpError) Error() string {
+	return fmt.Sprintf("failed to make http request for [service=%s][path=%s][httpstatus=%d][err=%s]", e.Service, e.Path, e.StatusCode, e.Body)
+}
+
+// httpTransport sends requests for one service, retrying network errors, 429 and 5xx responses
+// with exponential backoff and jitter, or after the delay the server asks for in Retry-After as
+// long as it is within the maximum backoff. Every attempt, retries included, waits for the rate limiter first.
+type httpTransport struct {
+	service string
+	client  *http.Client
+	policy  RetryPolicy
+	limiter *RateLimiter
+}
+
+// baseUrl returns configured with a trailing slash, or fallback when nothing is configured.
+func baseUrl(configured, fallback string) string {
+	if len(configured) == 0 {
+		return fallback
+	}
+	return strings.TrimSuffix(configured, "/") + "/"
+}
+
+func newHttpTransport(service string, client *http.Client, policy RetryPolicy, limiter *RateLimiter) *httpTransport {
+	if policy.MaxRetries == 0 {
+		policy.MaxRetries = DEFAULT_MAX_RETRIES
+	}
+	if policy.MaxRetries < 0 {
+		policy.MaxRetries = 0
+	}
+	if policy.InitialBackoff <= 0 {
+		policy.InitialBackoff = DEFAULT_INITIAL_BACKOFF
+	}
+	if policy.MaxBackoff <= 0 {
+		policy.MaxBackoff = DEFAULT_MAX_BACKOFF
+	}
+	return &httpTransport{service: service, client: client, policy: policy, limiter: limiter}
+}
+
+// do sends the request and returns the body of a 2xx response. path is only used for logging
+// and errors. Network errors and 5xx responses are only retried for idempotent requests, since
+// the server may already have processed them. Other requests are only retried on 429, and on
+// 503 when the server asks for it with Retry-After.
+func (t *httpTransport) do(method, requestUrl, path string, body []byte, header http.Header, idempotent bool) (string, error) {
+	for attempt := 0; ; attempt++ {
+		var bodyReader io.Reader
+		if body != nil {
+			bodyReader = bytes.NewReader(body)
+		}
+		req, err := http.NewRequest(method, requestUrl, bodyReader)
+		if err != nil {
+			return "", fmt.Errorf("failed to create http request for [path=%s][err=%v]", path, err)
+		}
+		for key, values := range header {
+			for _, value := range values {
+				req.Header.Add(key, value)
+			}
+		}
+		t.limiter.Wait()
+		response, err := t.client.Do(req)
+		if err != nil {
+			if attempt < t.policy.MaxRetries && idempotent {
+				t.wait(attempt, path, "", err)
+				continue
+			}
+			return "", fmt.Errorf("failed to send http request for [path=%s][err=%v]", path, err)
+		}
+		result, err := ioutil.ReadAll(response.Body)
+		response.Body.Close()
+		if err != nil {
+			if attempt < t.policy.MaxRetries && idempotent {
+				t.wait(attempt, path, "", err)
+				continue
+			}
+			return "", fmt.Errorf("failed to read http response for [path=%s][err=%v]", path, err)
+		}
+		if response.StatusCode >= 200 && response.StatusCode < 300 {
+			return string(result), nil
+		}
+		httpErr := &HttpError{Service: t.service, Path: path, StatusCode: response.StatusCode, Body: string(result)}
+		retryAfter := response.Header.Get("Retry-After")
+		if attempt < t.policy.MaxRetries && retryableStatus(idempotent, response.StatusCode, retryAfter) && t.wait(attempt, path, retryAfter, httpErr) {
+			continue
+		}
+		return "", httpErr
+	}
+}
+
+// wait sleeps before the next attempt. It returns false without sleeping when Retry-After asks
+// for longer than the maximum backoff, the request then fails instead of blocking the run.
+func (t *httpTransport) wait(attempt int, path, retryAfter string, err error) bool {
+	delay, ok := retryAfterDelay(retryAfter)
+	if ok && delay > t.policy.MaxBackoff {
+		log.Printf("Not retrying request [service=%s][path=%s][retryafter=%v][maxbackoff=%v][err=%v]", t.service, path, delay, t.policy.MaxBackoff, err)
+		return false
+	}
+	if !ok {
+		backoff := t.policy.InitialBackoff << uint(attempt)
+		if backoff <= 0 || backoff > t.policy.MaxBackoff {
+			backoff = t.policy.MaxBackoff
+		}
+		delay = backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+	}
+	log.Printf("Retrying request [service=%s][path=%s][attempt=%d/%d][wait=%v][err=%v]", t.service, path, attempt+1, t.policy.MaxRetries, delay, err)
+	time.Sleep(delay)
+	return true
+}
+
+// retryAfterDelay parses a Retry-After header given either in seconds or as an HTTP date.
+func retryAfterDelay(retryAfter string) (time.Duration, bool) {
+	if len(retryAfter) == 0 {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(retryAfter); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(retryAfter); err == nil {
+		delay := time.Until(date)
+		if delay < 0 {
+			delay = 0
+		}
+		return delay, true
+	}
+	return 0, false
+}
+
+func idempotentMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete, http.MethodOptions:
+		return true
+	default:
+		return false
+	}
+}
+
+func retryableStatus(idempotent bool, statusCode int, retryAfter string) bool {
+	switch statusCode {
+	case http.StatusTooManyRequests:
+		return true
+	case http.StatusServiceUnavailable:
+		if idempotent {
+			return true
+		}
+		_, ok := retryAfterDelay(retryAfter)
+		return ok
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusGatewayTimeout:
+		return idempotent
+	default:
+		return false
+	}
+}
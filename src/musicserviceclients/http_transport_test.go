@@ -0,0 +1,131 @@
+package musicserviceclients
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRetryableStatus(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		statusCode int
+		retryAfter string
+		expected   bool
+	}{
+		{"get too many requests", http.MethodGet, http.StatusTooManyRequests, "", true},
+		{"get internal server error", http.MethodGet, http.StatusInternalServerError, "", true},
+		{"put bad gateway", http.MethodPut, http.StatusBadGateway, "", true},
+		{"delete service unavailable", http.MethodDelete, http.StatusServiceUnavailable, "", true},
+		{"get gateway timeout", http.MethodGet, http.StatusGatewayTimeout, "", true},
+		{"get not found", http.MethodGet, http.StatusNotFound, "", false},
+		{"post too many requests", http.MethodPost, http.StatusTooManyRequests, "", true},
+		{"post service unavailable with retry after", http.MethodPost, http.StatusServiceUnavailable, "2", true},
+		{"post service unavailable", http.MethodPost, http.StatusServiceUnavailable, "", false},
+		{"post invalid retry after", http.MethodPost, http.StatusServiceUnavailable, "soon", false},
+		{"post internal server error", http.MethodPost, http.StatusInternalServerError, "", false},
+		{"post bad gateway", http.MethodPost, http.StatusBadGateway, "2", false},
+		{"post gateway timeout", http.MethodPost, http.StatusGatewayTimeout, "", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actual := retryableStatus(idempotentMethod(test.method), test.statusCode, test.retryAfter)
+			if actual != test.expected {
+				t.Errorf("retryableStatus(%s, %d, %q) = %v, want %v", test.method, test.statusCode, test.retryAfter, actual, test.expected)
+			}
+		})
+	}
+}
+
+func TestTransportRateLimit(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	transport := newHttpTransport(SERVICE_SPOTIFY, server.Client(), RetryPolicy{MaxRetries: -1}, NewRateLimiter(20))
+
+	start := time.Now()
+	for _, method := range []string{http.MethodGet, http.MethodPost, http.MethodDelete} {
+		_, err := transport.do(method, server.URL, "/", nil, nil, idempotentMethod(method))
+		if err != nil {
+			t.Fatalf("do() failed [method=%s][err=%v]", method, err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("sent 3 requests in %v, want at least 100ms at 20 requests per second", elapsed)
+	}
+}
+
+func TestTransportRetryAfter(t *testing.T) {
+	tests := []struct {
+		name       string
+		retryAfter string
+		requests   int32
+		statusCode int
+	}{
+		{"within max backoff", "0", 2, 0},
+		{"above max backoff", "3600", 1, http.StatusTooManyRequests},
+		{"http date above max backoff", time.Now().Add(time.Hour).UTC().Format(http.TimeFormat), 1, http.StatusTooManyRequests},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var requests int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if atomic.AddInt32(&requests, 1) == 1 {
+					w.Header().Set("Retry-After", test.retryAfter)
+					w.WriteHeader(http.StatusTooManyRequests)
+				}
+			}))
+			defer server.Close()
+			transport := newHttpTransport(SERVICE_SPOTIFY, server.Client(), RetryPolicy{MaxBackoff: time.Second}, NewRateLimiter(0))
+
+			start := time.Now()
+			_, err := transport.do(http.MethodGet, server.URL, "/", nil, nil, true)
+			var httpErr *HttpError
+			if test.statusCode == 0 && err != nil {
+				t.Errorf("do() failed [err=%v]", err)
+			}
+			if test.statusCode != 0 && (!errors.As(err, &httpErr) || httpErr.StatusCode != test.statusCode) {
+				t.Errorf("do() err = %v, want http status %d", err, test.statusCode)
+			}
+			if sent := atomic.LoadInt32(&requests); sent != test.requests {
+				t.Errorf("sent %d requests, want %d", sent, test.requests)
+			}
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Errorf("do() took %v, want at most the max backoff", elapsed)
+			}
+		})
+	}
+}
+
+func TestTransportErrors(t *testing.T) {
+	closed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	closed.Close()
+	truncated := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "100")
+		w.Write([]byte("partial"))
+		w.(http.Flusher).Flush()
+		panic(http.ErrAbortHandler)
+	}))
+	defer truncated.Close()
+	tests := []struct {
+		name     string
+		url      string
+		expected string
+	}{
+		{"network error", closed.URL, "failed to send http request"},
+		{"truncated body", truncated.URL, "failed to read http response"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			transport := newHttpTransport(SERVICE_SPOTIFY, truncated.Client(), RetryPolicy{MaxRetries: -1}, NewRateLimiter(0))
+			_, err := transport.do(http.MethodGet, test.url, "/", nil, nil, true)
+			if err == nil || !strings.Contains(err.Error(), test.expected) {
+				t.Errorf("do() err = %v, want %s", err, test.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package musicserviceclients
+
+import (
+	"fmt"
+	"musicserviceclients/matcher"
+)
+
+// albumSearcher is implemented by destination clients that can search their catalog for albums.
+type albumSearcher interface {
+	searchAlbums(album Album) ([]Album, error)
+}
+
+// artistSearcher is implemented by destination clients that can search their catalog for
+// artists.
+type artistSearcher interface {
+	searchArtists(artist Artist) ([]Artist, error)
+}
+
+// resolveAlbums finds the destination album of every source album, scoring the search results
+// on name and artists. It returns the matched albums and the errors of the others.
+func (r *trackResolver) resolveAlbums(searcher albumSearcher, albums []Album) ([]Album, []error) {
+	var resolved []Album
+	var errorList []error
+	for _, album := range albums {
+		results, err := searcher.searchAlbums(album)
+		if err != nil {
+			errorList = append(errorList, fmt.Errorf("failed to search album [album=%s][err=%w]", album.Name, err))
+			continue
+		}
+		var tracks []matcher.Track
+		for _, result := range results {
+			tracks = append(tracks, albumTrack(result))
+		}
+		best, ok := r.matcher.Best(albumTrack(album), tracks)
+		if !ok {
+			errorList = append(errorList, fmt.Errorf("failed to find a match [album=%s]", album.Name))
+			continue
+		}
+		resolved = append(resolved, results[best.Index])
+	}
+	return resolved, errorList
+}
+
+// resolveArtists finds the destination artist of every source artist by name.
+func (r *trackResolver) resolveArtists(searcher artistSearcher, artists []Artist) ([]Artist, []error) {
+	var resolved []Artist
+	var errorList []error
+	for _, artist := range artists {
+		results, err := searcher.searchArtists(artist)
+		if err != nil {
+			errorList = append(errorList, fmt.Errorf("failed to search artist [artist=%s][err=%w]", artist.Name, err))
+			continue
+		}
+		var tracks []matcher.Track
+		for _, result := range results {
+			tracks = append(tracks, matcher.Track{Title: result.Name})
+		}
+		best, ok := r.matcher.Best(matcher.Track{Title: artist.Name}, tracks)
+		if !ok {
+			errorList = append(errorList, fmt.Errorf("failed to find a match [artist=%s]", artist.Name))
+			continue
+		}
+		resolved = append(resolved, results[best.Index])
+	}
+	return resolved, errorList
+}
+
+// albumTrack compares albums like tracks titled with the album name.
+func albumTrack(album Album) matcher.Track {
+	track := matcher.Track{Title: album.Name}
+	for _, artist := range album.Artists {
+		track.Artists = append(track.Artists, artist.Name)
+	}
+	return track
+}
@@ -0,0 +1,235 @@
+package matcher
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const DEFAULT_THRESHOLD = 0.7
+
+// Two accepted candidates scoring within this margin of each other are too close to tell apart.
+const AMBIGUITY_MARGIN = 0.05
+
+const (
+	TITLE_WEIGHT    = 0.45
+	ARTIST_WEIGHT   = 0.35
+	ALBUM_WEIGHT    = 0.1
+	DURATION_WEIGHT = 0.1
+)
+
+// Candidates containing one of these words when the source does not are most likely a
+// different recording of the same song.
+const VERSION_PENALTY = 0.5
+
+var versionWords = []string{"live", "karaoke", "cover", "instrumental", "acoustic", "remix", "tribute", "originally performed", "made famous", "in the style of", "demo"}
+
+const (
+	DURATION_TOLERANCE = 2 * time.Second
+	DURATION_MAX_DELTA = 30 * time.Second
+)
+
+var (
+	featuringPattern = regexp.MustCompile(`(?i)[(\[]?\s*\b(feat|ft|featuring)\b\.?\s[^)\]]*[)\]]?`)
+	editionPattern   = regexp.MustCompile(`(?i)([(\[][^)\]]*\b(remaster(ed)?|radio edit|single version|album version|mono|stereo|deluxe|explicit|bonus track)\b[^)\]]*[)\]]|\s-\s.*\b(remaster(ed)?|radio edit|single version|album version|mono|stereo)\b.*$)`)
+)
+
+// Track is the metadata the matcher compares. Empty fields and zero durations are unknown and
+// do not count towards the score.
+type Track struct {
+	Title    string
+	Artists  []string
+	Album    string
+	Duration time.Duration
+	Isrc     string
+}
+
+type Candidate struct {
+	Index int
+	Score float64
+}
+
+type Matcher struct {
+	Threshold float64
+}
+
+func NewMatcher(threshold float64) *Matcher {
+	return &Matcher{Threshold: threshold}
+}
+
+// Score returns how similar candidate is to source, between 0 and 1. Tracks sharing an ISRC
+// are the same recording and always score 1.
+func (m *Matcher) Score(source, candidate Track) float64 {
+	if len(source.Isrc) > 0 && strings.EqualFold(source.Isrc, candidate.Isrc) {
+		return 1
+	}
+	score := TITLE_WEIGHT * similarity(normalizeTitle(source.Title), normalizeTitle(candidate.Title))
+	weight := TITLE_WEIGHT
+	if len(source.Artists) > 0 && len(candidate.Artists) > 0 {
+		score += ARTIST_WEIGHT * artistSimilarity(source.Artists, candidate.Artists)
+		weight += ARTIST_WEIGHT
+	}
+	if len(source.Album) > 0 && len(candidate.Album) > 0 {
+		score += ALBUM_WEIGHT * similarity(normalizeTitle(source.Album), normalizeTitle(candidate.Album))
+		weight += ALBUM_WEIGHT
+	}
+	if source.Duration > 0 && candidate.Duration > 0 {
+		score += DURATION_WEIGHT * durationSimilarity(source.Duration, candidate.Duration)
+		weight += DURATION_WEIGHT
+	}
+	score /= weight
+	if hasVersionMismatch(source, candidate) {
+		score *= VERSION_PENALTY
+	}
+	return score
+}
+
+// Rank scores every candidate and returns them best first.
+func (m *Matcher) Rank(source Track, candidates []Track) []Candidate {
+	ranked := make([]Candidate, len(candidates))
+	for i, candidate := range candidates {
+		ranked[i] = Candidate{Index: i, Score: m.Score(source, candidate)}
+	}
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return ranked[i].Score > ranked[j].Score
+	})
+	return ranked
+}
+
+// Best returns the highest scoring candidate and whether it reaches the threshold.
+func (m *Matcher) Best(source Track, candidates []Track) (Candidate, bool) {
+	ranked := m.Rank(source, candidates)
+	if len(ranked) == 0 {
+		return Candidate{Index: -1}, false
+	}
+	return ranked[0], ranked[0].Score >= m.Threshold
+}
+
+// Ambiguous reports whether the runner-up is also accepted and scores within AMBIGUITY_MARGIN
+// of the best candidate.
+func (m *Matcher) Ambiguous(best, runnerUp float64) bool {
+	return runnerUp >= m.Threshold && best-runnerUp < AMBIGUITY_MARGIN
+}
+
+// Normalize lower cases value and reduces it to space separated letters and digits.
+func Normalize(value string) string {
+	var builder strings.Builder
+	for _, r := range strings.ToLower(value) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			builder.WriteRune(foldRune(r))
+		case r == '&':
+			builder.WriteString(" and ")
+		case r == '\'':
+		default:
+			builder.WriteRune(' ')
+		}
+	}
+	return strings.Join(strings.Fields(builder.String()), " ")
+}
+
+func normalizeTitle(title string) string {
+	title = featuringPattern.ReplaceAllString(title, " ")
+	title = editionPattern.ReplaceAllString(title, " ")
+	return Normalize(title)
+}
+
+func artistSimilarity(sourceArtists, candidateArtists []string) float64 {
+	var candidates []string
+	for _, artist := range candidateArtists {
+		candidates = append(candidates, Normalize(artist))
+	}
+	joined := strings.Join(candidates, " ")
+	total := 0.0
+	for _, artist := range sourceArtists {
+		normalized := Normalize(artist)
+		best := 0.0
+		if len(normalized) > 0 && strings.Contains(" "+joined+" ", " "+normalized+" ") {
+			best = 1
+		}
+		for _, candidate := range candidates {
+			if s := similarity(normalized, candidate); s > best {
+				best = s
+			}
+		}
+		total += best
+	}
+	return total / float64(len(sourceArtists))
+}
+
+func durationSimilarity(source, candidate time.Duration) float64 {
+	delta := source - candidate
+	if delta < 0 {
+		delta = -delta
+	}
+	if delta <= DURATION_TOLERANCE {
+		return 1
+	}
+	if delta >= DURATION_MAX_DELTA {
+		return 0
+	}
+	return 1 - float64(delta-DURATION_TOLERANCE)/float64(DURATION_MAX_DELTA-DURATION_TOLERANCE)
+}
+
+func hasVersionMismatch(source, candidate Track) bool {
+	sourceText := " " + Normalize(source.Title+" "+source.Album) + " "
+	candidateText := " " + Normalize(candidate.Title+" "+candidate.Album) + " "
+	for _, word := range versionWords {
+		if strings.Contains(candidateText, " "+word+" ") && !strings.Contains(sourceText, " "+word+" ") {
+			return true
+		}
+	}
+	return false
+}
+
+// similarity is the normalized Levenshtein similarity of two strings, between 0 and 1.
+func similarity(a, b string) float64 {
+	if a == b {
+		return 1
+	}
+	ar, br := []rune(a), []rune(b)
+	if len(ar) == 0 || len(br) == 0 {
+		return 0
+	}
+	previous := make([]int, len(br)+1)
+	current := make([]int, len(br)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(ar); i++ {
+		current[0] = i
+		for j := 1; j <= len(br); j++ {
+			cost := 1
+			if ar[i-1] == br[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	longest := len(ar)
+	if len(br) > longest {
+		longest = len(br)
+	}
+	return 1 - float64(previous[len(br)])/float64(longest)
+}
+
+var foldedRunes = map[rune]rune{
+	'à': 'a', 'á': 'a', 'â': 'a', 'ã': 'a', 'ä': 'a', 'å': 'a',
+	'ç': 'c',
+	'è': 'e', 'é': 'e', 'ê': 'e', 'ë': 'e',
+	'ì': 'i', 'í': 'i', 'î': 'i', 'ï': 'i',
+	'ñ': 'n',
+	'ò': 'o', 'ó': 'o', 'ô': 'o', 'õ': 'o', 'ö': 'o', 'ø': 'o',
+	'ù': 'u', 'ú': 'u', 'û': 'u', 'ü': 'u',
+	'ý': 'y', 'ÿ': 'y',
+}
+
+func foldRune(r rune) rune {
+	if folded, ok := foldedRunes[r]; ok {
+		return folded
+	}
+	return r
+}
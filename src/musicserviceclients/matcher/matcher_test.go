@@ -0,0 +1,127 @@
+package matcher
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestNormalizeTitle(t *testing.T) {
+	tests := []struct {
+		title    string
+		expected string
+	}{
+		{"Mr. Brightside", "mr brightside"},
+		{"Don't Stop Me Now", "dont stop me now"},
+		{"Rock & Roll", "rock and roll"},
+		{"Café Del Mar", "cafe del mar"},
+		{"Stay (feat. Justin Bieber)", "stay"},
+		{"Stay [ft. Justin Bieber]", "stay"},
+		{"Stay featuring Justin Bieber", "stay"},
+		{"Here Comes the Sun (Remastered 2009)", "here comes the sun"},
+		{"Here Comes the Sun - Remastered 2009", "here comes the sun"},
+		{"Wonderwall - Radio Edit", "wonderwall"},
+		{"Hey Jude (Mono)", "hey jude"},
+		{"Hotel California (Live)", "hotel california live"},
+		{"Hotel California - Live at the Forum", "hotel california live at the forum"},
+	}
+	for _, test := range tests {
+		t.Run(test.title, func(t *testing.T) {
+			if actual := normalizeTitle(test.title); actual != test.expected {
+				t.Errorf("normalizeTitle(%q) = %q, want %q", test.title, actual, test.expected)
+			}
+		})
+	}
+}
+
+func TestDurationSimilarity(t *testing.T) {
+	tests := []struct {
+		name      string
+		source    time.Duration
+		candidate time.Duration
+		expected  float64
+	}{
+		{"equal", 200 * time.Second, 200 * time.Second, 1},
+		{"within tolerance", 200 * time.Second, 202 * time.Second, 1},
+		{"within tolerance shorter", 200 * time.Second, 198 * time.Second, 1},
+		{"halfway", 200 * time.Second, 216 * time.Second, 0.5},
+		{"max delta", 200 * time.Second, 230 * time.Second, 0},
+		{"beyond max delta", 200 * time.Second, 300 * time.Second, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actual := durationSimilarity(test.source, test.candidate)
+			if math.Abs(actual-test.expected) > 1e-9 {
+				t.Errorf("durationSimilarity(%v, %v) = %v, want %v", test.source, test.candidate, actual, test.expected)
+			}
+		})
+	}
+}
+
+func TestBest(t *testing.T) {
+	source := Track{Title: "Dreams", Artists: []string{"Fleetwood Mac"}, Album: "Rumours", Duration: 257 * time.Second, Isrc: "USWB10400049"}
+	tests := []struct {
+		name       string
+		candidates []Track
+		index      int
+		accepted   bool
+	}{
+		{"no candidates", nil, -1, false},
+		{"exact", []Track{{Title: "Dreams", Artists: []string{"Fleetwood Mac"}, Album: "Rumours", Duration: 257 * time.Second}}, 0, true},
+		{"remaster with featured artist", []Track{
+			{Title: "Landslide", Artists: []string{"Fleetwood Mac"}},
+			{Title: "Dreams - 2004 Remaster", Artists: []string{"Fleetwood Mac", "Stevie Nicks"}, Album: "Rumours (Super Deluxe)", Duration: 258 * time.Second}}, 1, true},
+		{"isrc wins", []Track{
+			{Title: "Dreams", Artists: []string{"The Cranberries"}},
+			{Title: "Dreams (Remastered)", Isrc: "USWB10400049"}}, 1, true},
+		{"live version below threshold", []Track{{Title: "Dreams (Live)", Artists: []string{"Fleetwood Mac"}, Album: "Rumours", Duration: 257 * time.Second}}, 0, false},
+		{"different song below threshold", []Track{{Title: "Go Your Own Way", Artists: []string{"Fleetwood Mac"}, Album: "Rumours"}}, 0, false},
+	}
+	matcher := NewMatcher(DEFAULT_THRESHOLD)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			best, accepted := matcher.Best(source, test.candidates)
+			if best.Index != test.index || accepted != test.accepted {
+				t.Errorf("Best() = [index=%d][score=%.2f][accepted=%v], want [index=%d][accepted=%v]", best.Index, best.Score, accepted, test.index, test.accepted)
+			}
+		})
+	}
+}
+
+func TestThreshold(t *testing.T) {
+	source := Track{Title: "Dreams", Artists: []string{"Fleetwood Mac"}}
+	candidate := Track{Title: "Dreamer", Artists: []string{"Fleetwood Mac"}}
+	score := NewMatcher(DEFAULT_THRESHOLD).Score(source, candidate)
+	tests := []struct {
+		threshold float64
+		accepted  bool
+	}{
+		{score - 0.01, true},
+		{score, true},
+		{score + 0.01, false},
+	}
+	for _, test := range tests {
+		_, accepted := NewMatcher(test.threshold).Best(source, []Track{candidate})
+		if accepted != test.accepted {
+			t.Errorf("Best() with threshold %.2f for score %.2f accepted=%v, want %v", test.threshold, score, accepted, test.accepted)
+		}
+	}
+}
+
+func TestAmbiguous(t *testing.T) {
+	tests := []struct {
+		best     float64
+		runnerUp float64
+		expected bool
+	}{
+		{0.95, 0.93, true},
+		{0.95, 0.85, false},
+		{0.72, 0.69, false},
+	}
+	matcher := NewMatcher(DEFAULT_THRESHOLD)
+	for _, test := range tests {
+		if actual := matcher.Ambiguous(test.best, test.runnerUp); actual != test.expected {
+			t.Errorf("Ambiguous(%.2f, %.2f) = %v, want %v", test.best, test.runnerUp, actual, test.expected)
+		}
+	}
+}
@@ -1,29 +1,198 @@
 package musicserviceclients
 
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrPlaylistNotFound = errors.New("playlist not found")
+
 type Album struct {
-	Name string
+	Name    string
+	Upc     string
+	Id      string
+	Artists []Artist
 }
 
 type Artist struct {
 	Name string
+	Id   string
 }
 
+// ServiceId is the id and, where the service has them, the URI of an item on one service.
+type ServiceId struct {
+	Id  string
+	Uri string
+}
+
+// UnmigratableReason tells why a playlist item cannot be looked up on another service.
+type UnmigratableReason string
+
+const (
+	UNMIGRATABLE_LOCAL_FILE  UnmigratableReason = "local file"
+	UNMIGRATABLE_EPISODE     UnmigratableReason = "episode"
+	UNMIGRATABLE_UNAVAILABLE UnmigratableReason = "unavailable"
+	UNMIGRATABLE_REMOVED     UnmigratableReason = "removed"
+)
+
+// Song is a track as the service it was listed from knows it. Numbers and the year are zero
+// when unknown. ServiceIds is keyed by service name. Unmigratable is set for playlist items
+// that are not catalog tracks, such as local files and podcast episodes.
 type Song struct {
-	Name    string
-	Album   Album
-	Artists []Artist
+	Name         string
+	Album        Album
+	Artists      []Artist
+	Id           string
+	Duration     time.Duration
+	Isrc         string
+	DiscNumber   int
+	TrackNumber  int
+	Explicit     bool
+	Year         int
+	ServiceIds   map[string]ServiceId
+	Unmigratable UnmigratableReason
 }
 
+type Visibility string
+
+const (
+	VISIBILITY_PUBLIC  Visibility = "public"
+	VISIBILITY_PRIVATE Visibility = "private"
+)
+
+// Playlist is a playlist with its songs. An empty Visibility is unknown and destinations then
+// create the playlist private. CoverImageUrl is the artwork the source shows for it, if any.
 type Playlist struct {
-	Name        string
-	Description string
-	Id          string
-	Songs       []Song
+	Name          string
+	Description   string
+	Id            string
+	Songs         []Song
+	Visibility    Visibility
+	Collaborative bool
+	CoverImageUrl string
+}
+
+func (p Playlist) Public() bool {
+	return p.Visibility == VISIBILITY_PUBLIC
+}
+
+type MatchStatus string
+
+const (
+	MATCH_MATCHED   MatchStatus = "matched"
+	MATCH_AMBIGUOUS MatchStatus = "ambiguous"
+	MATCH_NOT_FOUND MatchStatus = "not found"
+	MATCH_FAILED    MatchStatus = "failed"
+)
+
+// TrackMatch is the destination track chosen for a source song. Ambiguous matches carry the
+// best scoring track, which is still added. Mapped matches were taken from the recorded mapping
+// without a lookup, so their Track only carries the destination id.
+type TrackMatch struct {
+	Source Song
+	Track  *Song
+	Score  float64
+	Status MatchStatus
+	Mapped bool
+	Err    error
 }
 
+// PlaylistResult is the playlist CreatePlaylist created and how each song was matched. Id is
+// empty in a dry run.
+type PlaylistResult struct {
+	Id      string
+	Matches []TrackMatch
+}
+
+// PlaylistFilter selects playlists by name and id before their songs are listed. A nil filter
+// selects every playlist.
+type PlaylistFilter func(name, id string) bool
+
 type MediaServiceClient interface {
 	Login() error
 	ListPlaylist(string) (*Playlist, error)
 	ListAllPlaylists() ([]Playlist, error)
-	CreatePlaylist(string, string, []Song) error
+	ListPlaylists(PlaylistFilter) ([]Playlist, error)
+	GetPlaylist(string) (*Playlist, error)
+	CreatePlaylist(Playlist) (*PlaylistResult, error)
+	AddTracks(string, []Song) ([]TrackMatch, error)
+	RemoveTracks(string, []Song) error
+	// The library methods return an error wrapping errors.ErrUnsupported when the service has
+	// no such library. SaveAlbums and FollowArtists return the destination items they matched.
+	ListSavedTracks() ([]Song, error)
+	ListSavedAlbums() ([]Album, error)
+	ListFollowedArtists() ([]Artist, error)
+	SaveTracks([]Song) ([]TrackMatch, error)
+	SaveAlbums([]Album) ([]Album, error)
+	FollowArtists([]Artist) ([]Artist, error)
+}
+
+// TrackMapping remembers the destination track a source song was matched to, so repeated
+// runs do not have to search for it again.
+type TrackMapping interface {
+	DestinationTrack(Song) (string, bool)
+	RecordTrack(Song, string)
+}
+
+// Credential is a secret a client can log in again with without asking, such as a refresh token.
+type Credential struct {
+	Account string
+	Secret  string
+}
+
+// CredentialCache keeps credentials per service and account across runs. An empty account
+// matches any cached account of the service.
+type CredentialCache interface {
+	Credential(service, account string) (Credential, bool)
+	SaveCredential(service string, credential Credential) error
+}
+
+// SamePlaylistName compares playlist names ignoring case and surrounding whitespace.
+func SamePlaylistName(a, b string) bool {
+	return strings.EqualFold(strings.TrimSpace(a), strings.TrimSpace(b))
+}
+
+// serviceIds returns the ids of an item found on service, nil when it has no id there.
+func serviceIds(service, id, uri string) map[string]ServiceId {
+	if len(id) == 0 {
+		return nil
+	}
+	return map[string]ServiceId{service: {Id: id, Uri: uri}}
+}
+
+// releaseYear parses the year of a release date such as "1977", "1977-02" or "1977-02-04".
+func releaseYear(date string) int {
+	if len(date) < 4 {
+		return 0
+	}
+	year, err := strconv.Atoi(date[:4])
+	if err != nil {
+		return 0
+	}
+	return year
+}
+
+// SplitMigratable separates the songs that can be searched for on another service from the
+// ones that cannot, keeping their order.
+func SplitMigratable(songs []Song) ([]Song, []Song) {
+	var migratable, unmigratable []Song
+	for _, song := range songs {
+		if len(song.Unmigratable) > 0 {
+			unmigratable = append(unmigratable, song)
+		} else {
+			migratable = append(migratable, song)
+		}
+	}
+	return migratable, unmigratable
+}
+
+// SongKey identifies a song across services by its normalized first artist and title.
+func SongKey(song Song) string {
+	artist := ""
+	if len(song.Artists) > 0 {
+		artist = song.Artists[0].Name
+	}
+	return strings.ToLower(strings.Join(strings.Fields(artist), " ") + " - " + strings.Join(strings.Fields(song.Name), " "))
 }
@@ -1,10 +1,14 @@
 package models
 
 const (
-	GPM_PLAYLIST_TYPE              = "USER_GENERATED"
-	GPM_PLAYLIST_SHARESTATE_PUBLIC = "PUBLIC"
+	GPM_PLAYLIST_TYPE               = "USER_GENERATED"
+	GPM_PLAYLIST_SHARESTATE_PUBLIC  = "PUBLIC"
+	GPM_PLAYLIST_SHARESTATE_PRIVATE = "PRIVATE"
 )
 
+// explicitType of tracks with explicit lyrics. Clean versions and other tracks use other values.
+const GPM_EXPLICIT_TYPE_EXPLICIT = "1"
+
 type GpmCreatePlaylist struct {
 	CreationTimestamp     string `json:"creationTimestamp"`
 	Deleted               bool   `json:"deleted"`
@@ -35,6 +39,14 @@ type GpmCreateSongEntryMutations struct {
 	Mutations []GpmCreateSongEntry `json:"mutations"`
 }
 
+type GpmDeleteSongEntry struct {
+	Delete string `json:"delete"`
+}
+
+type GpmDeleteSongEntryMutations struct {
+	Mutations []GpmDeleteSongEntry `json:"mutations"`
+}
+
 type GpmAddTracksResponse struct {
 	Id           string `json:"id"`
 	ResponseCode string `json:"response_code"`
@@ -62,18 +74,102 @@ type GpmCreatePlaylistMutationsResponse struct {
 }
 
 type TrackItem struct {
-	Name   string `json:"title"`
-	Artist string `json:"artist"`
-	Album  string `json:"album"`
-	Id     string `json:"storeId"`
+	Name           string   `json:"title"`
+	Artist         string   `json:"artist"`
+	Album          string   `json:"album"`
+	AlbumArtist    string   `json:"albumArtist"`
+	AlbumId        string   `json:"albumId"`
+	ArtistId       []string `json:"artistId"`
+	Id             string   `json:"storeId"`
+	LibraryId      string   `json:"id"`
+	Nid            string   `json:"nid"`
+	DurationMillis string   `json:"durationMillis"`
+	DiscNumber     int      `json:"discNumber"`
+	TrackNumber    int      `json:"trackNumber"`
+	Year           int      `json:"year"`
+	ExplicitType   string   `json:"explicitType"`
+	Deleted        bool     `json:"deleted"`
+}
+
+type GpmAlbum struct {
+	Name        string      `json:"name"`
+	AlbumArtist string      `json:"albumArtist"`
+	AlbumId     string      `json:"albumId"`
+	Tracks      []TrackItem `json:"tracks"`
 }
 
 type GpmSearchItem struct {
 	ItemType string    `json:"type"`
 	Track    TrackItem `json:"track"`
+	Album    GpmAlbum  `json:"album"`
 }
 
 type GpmSearchResponse struct {
 	SuggestedQuery string          `json:"suggestedQuery"`
 	Entries        []GpmSearchItem `json:"entries"`
 }
+
+// GpmTrackMutation adds a store track to the library. The track is the one fetchtrack
+// returned, with the library fields set.
+type GpmTrackMutation struct {
+	Create map[string]interface{} `json:"create"`
+}
+
+type GpmTrackMutations struct {
+	Mutations []GpmTrackMutation `json:"mutations"`
+}
+
+type GpmFeedRequest struct {
+	MaxResults string `json:"max-results"`
+	StartToken string `json:"start-token,omitempty"`
+}
+
+type GpmArtRef struct {
+	Url string `json:"url"`
+}
+
+type GpmPlaylist struct {
+	Id           string      `json:"id"`
+	Name         string      `json:"name"`
+	Description  string      `json:"description"`
+	Deleted      bool        `json:"deleted"`
+	PlaylistType string      `json:"type"`
+	ShareState   string      `json:"shareState"`
+	AlbumArtRef  []GpmArtRef `json:"albumArtRef"`
+}
+
+type GpmPlaylistFeedData struct {
+	Items []GpmPlaylist `json:"items"`
+}
+
+type GpmPlaylistFeedResponse struct {
+	NextPageToken string              `json:"nextPageToken"`
+	Data          GpmPlaylistFeedData `json:"data"`
+}
+
+type GpmPlaylistEntry struct {
+	Id               string     `json:"id"`
+	PlayListId       string     `json:"playlistId"`
+	SongId           string     `json:"trackId"`
+	AbsolutePosition string     `json:"absolutePosition"`
+	Deleted          bool       `json:"deleted"`
+	Track            *TrackItem `json:"track"`
+}
+
+type GpmPlaylistEntryFeedData struct {
+	Items []GpmPlaylistEntry `json:"items"`
+}
+
+type GpmPlaylistEntryFeedResponse struct {
+	NextPageToken string                   `json:"nextPageToken"`
+	Data          GpmPlaylistEntryFeedData `json:"data"`
+}
+
+type GpmTrackFeedData struct {
+	Items []TrackItem `json:"items"`
+}
+
+type GpmTrackFeedResponse struct {
+	NextPageToken string           `json:"nextPageToken"`
+	Data          GpmTrackFeedData `json:"data"`
+}
@@ -5,22 +5,67 @@ type SpotifyUser struct {
 	Id   string `json:"id"`
 }
 
+type SpotifyExternalIds struct {
+	Isrc string `json:"isrc"`
+	Upc  string `json:"upc"`
+}
+
 type SpotifyAlbum struct {
-	Name string `json:"name"`
+	Name                 string             `json:"name"`
+	Id                   string             `json:"id"`
+	Uri                  string             `json:"uri"`
+	ReleaseDate          string             `json:"release_date"`
+	ReleaseDatePrecision string             `json:"release_date_precision"`
+	Artists              []SpotifyArtist    `json:"artists"`
+	ExternalIds          SpotifyExternalIds `json:"external_ids"`
 }
 
 type SpotifyArtist struct {
 	Name string `json:"name"`
+	Id   string `json:"id"`
+	Uri  string `json:"uri"`
 }
 
+const (
+	SPOTIFY_TYPE_TRACK   = "track"
+	SPOTIFY_TYPE_EPISODE = "episode"
+)
+
+// Restriction reasons that keep a track from being played at all. Tracks restricted for being
+// explicit are still in the catalog.
+const (
+	SPOTIFY_RESTRICTION_MARKET  = "market"
+	SPOTIFY_RESTRICTION_PRODUCT = "product"
+)
+
+// SpotifyTrackWrapper is a playlist or library item. Track is null when the track was removed
+// from the catalog.
 type SpotifyTrackWrapper struct {
-	Track SpotifyTrack `json:"track"`
+	Track   *SpotifyTrack `json:"track"`
+	IsLocal bool          `json:"is_local"`
 }
 
+type SpotifyRestrictions struct {
+	Reason string `json:"reason"`
+}
+
+// SpotifyTrack is a track or, in playlists, a podcast episode. IsPlayable is only sent when a
+// market was requested.
 type SpotifyTrack struct {
-	Name    string          `json:"name"`
-	Album   SpotifyAlbum    `json:"album"`
-	Artists []SpotifyArtist `json:"artists"`
+	Name         string               `json:"name"`
+	Id           string               `json:"id"`
+	Uri          string               `json:"uri"`
+	Type         string               `json:"type"`
+	IsLocal      bool                 `json:"is_local"`
+	IsPlayable   *bool                `json:"is_playable"`
+	Restrictions *SpotifyRestrictions `json:"restrictions"`
+	DurationMs   int                  `json:"duration_ms"`
+	DiscNumber   int                  `json:"disc_number"`
+	TrackNumber  int                  `json:"track_number"`
+	Explicit     bool                 `json:"explicit"`
+	Album        SpotifyAlbum         `json:"album"`
+	Artists      []SpotifyArtist      `json:"artists"`
+	ExternalIds  SpotifyExternalIds   `json:"external_ids"`
 }
 
 type SpotifyPlaylistTracks struct {
@@ -42,10 +87,116 @@ type SpotifyPlaylists struct {
 	Total     int               `json:"total"`
 }
 
+type SpotifyImage struct {
+	Url    string `json:"url"`
+	Height int    `json:"height"`
+	Width  int    `json:"width"`
+}
+
+// SpotifyPlaylist is a playlist without its tracks. Public is null when Spotify does not know
+// whether the playlist is public. Images are ordered largest first.
 type SpotifyPlaylist struct {
-	Name        string                `json:"name"`
-	Id          string                `json:"id"`
-	Description string                `json:"description"`
-	Tracks      SpotifyPlaylistTracks `json:"tracks"`
-	Owner       SpotifyPlaylistsOwner `json:"owner"`
+	Name          string                `json:"name"`
+	Id            string                `json:"id"`
+	Description   string                `json:"description"`
+	Public        *bool                 `json:"public"`
+	Collaborative bool                  `json:"collaborative"`
+	Images        []SpotifyImage        `json:"images"`
+	Tracks        SpotifyPlaylistTracks `json:"tracks"`
+	Owner         SpotifyPlaylistsOwner `json:"owner"`
+	SnapshotId    string                `json:"snapshot_id"`
+}
+
+type SpotifySearchTracks struct {
+	Tracks []SpotifyTrack `json:"items"`
+	Limit  int            `json:"limit"`
+	Offset int            `json:"offset"`
+	Total  int            `json:"total"`
+}
+
+type SpotifySearchAlbums struct {
+	Albums []SpotifyAlbum `json:"items"`
+	Limit  int            `json:"limit"`
+	Offset int            `json:"offset"`
+	Total  int            `json:"total"`
+}
+
+type SpotifySearchResponse struct {
+	Tracks  SpotifySearchTracks `json:"tracks"`
+	Albums  SpotifySearchAlbums `json:"albums"`
+	Artists SpotifyArtistsPage  `json:"artists"`
+}
+
+type SpotifySavedTracks struct {
+	Tracks []SpotifyTrackWrapper `json:"items"`
+	Limit  int                   `json:"limit"`
+	Offset int                   `json:"offset"`
+	Total  int                   `json:"total"`
+}
+
+type SpotifySavedAlbum struct {
+	Album SpotifyAlbum `json:"album"`
+}
+
+type SpotifySavedAlbums struct {
+	Albums []SpotifySavedAlbum `json:"items"`
+	Limit  int                 `json:"limit"`
+	Offset int                 `json:"offset"`
+	Total  int                 `json:"total"`
+}
+
+type SpotifyCursors struct {
+	After string `json:"after"`
+}
+
+type SpotifyArtistsPage struct {
+	Artists []SpotifyArtist `json:"items"`
+	Next    string          `json:"next"`
+	Cursors SpotifyCursors  `json:"cursors"`
+	Total   int             `json:"total"`
+}
+
+type SpotifyFollowedArtists struct {
+	Artists SpotifyArtistsPage `json:"artists"`
+}
+
+type SpotifyIdsRequest struct {
+	Ids []string `json:"ids"`
+}
+
+type SpotifyCreatePlaylistRequest struct {
+	Name          string `json:"name"`
+	Description   string `json:"description"`
+	Public        bool   `json:"public"`
+	Collaborative bool   `json:"collaborative"`
+}
+
+type SpotifyAddTracksRequest struct {
+	Uris []string `json:"uris"`
+}
+
+type SpotifyAddTracksResponse struct {
+	SnapshotId string `json:"snapshot_id"`
+}
+
+type SpotifyTrackUri struct {
+	Uri       string `json:"uri"`
+	Positions []int  `json:"positions,omitempty"`
+}
+
+type SpotifyRemoveTracksRequest struct {
+	Tracks     []SpotifyTrackUri `json:"tracks"`
+	SnapshotId string            `json:"snapshot_id,omitempty"`
+}
+
+type SpotifyRemoveTracksResponse struct {
+	SnapshotId string `json:"snapshot_id"`
+}
+
+type SpotifyTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	Scope        string `json:"scope"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
 }
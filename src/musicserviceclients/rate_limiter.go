@@ -0,0 +1,37 @@
+package musicserviceclients
+
+import (
+	"sync"
+	"time"
+)
+
+// RateLimiter spaces calls to Wait evenly so that at most a fixed number of requests per second
+// go out, however many goroutines share it. A nil RateLimiter never waits.
+type RateLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+// NewRateLimiter returns nil, an unlimited limiter, when requestsPerSecond is not positive.
+func NewRateLimiter(requestsPerSecond float64) *RateLimiter {
+	if requestsPerSecond <= 0 {
+		return nil
+	}
+	return &RateLimiter{interval: time.Duration(float64(time.Second) / requestsPerSecond)}
+}
+
+func (l *RateLimiter) Wait() {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	wait := l.next.Sub(now)
+	l.next = l.next.Add(l.interval)
+	l.mu.Unlock()
+	time.Sleep(wait)
+}
@@ -0,0 +1,146 @@
+package musicserviceclients
+
+import (
+	"fmt"
+	"musicserviceclients/matcher"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+type Capability int
+
+const (
+	CAPABILITY_READ Capability = 1 << iota
+	CAPABILITY_WRITE
+	CAPABILITY_SEARCH
+	CAPABILITY_LIBRARY
+)
+
+var capabilityNames = []struct {
+	capability Capability
+	name       string
+}{
+	{CAPABILITY_READ, "read"},
+	{CAPABILITY_WRITE, "write"},
+	{CAPABILITY_SEARCH, "search"},
+	{CAPABILITY_LIBRARY, "library"},
+}
+
+func (c Capability) Has(capability Capability) bool {
+	return c&capability == capability
+}
+
+func (c Capability) String() string {
+	var names []string
+	for _, capabilityName := range capabilityNames {
+		if c.Has(capabilityName.capability) {
+			names = append(names, capabilityName.name)
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+// ServiceConfig carries the settings a backend may need to construct its client.
+type ServiceConfig struct {
+	Directory          string
+	TrackMapping       TrackMapping
+	Matcher            *matcher.Matcher
+	Workers            int
+	RequestsPerSecond  float64
+	RetryPolicy        RetryPolicy
+	Spotify            SpotifyConfig
+	Gpm                GpmConfig
+	HttpClient         *http.Client
+	Transport          http.RoundTripper
+	Credentials        CredentialCache
+	CredentialProvider CredentialProvider
+	Account            string
+	DryRun             bool
+	Reviewer           Reviewer
+}
+
+// httpClient returns the configured client, or one sending requests through the configured
+// RoundTripper, which defaults to http.DefaultTransport.
+func httpClient(config ServiceConfig) *http.Client {
+	if config.HttpClient != nil {
+		return config.HttpClient
+	}
+	return &http.Client{Transport: config.Transport}
+}
+
+const DEFAULT_WORKERS = 4
+
+const DEFAULT_REQUESTS_PER_SECOND = 10
+
+type ServiceConstructor func(config ServiceConfig) (MediaServiceClient, error)
+
+type Service struct {
+	Name         string
+	Description  string
+	Constructor  ServiceConstructor
+	Capabilities Capability
+}
+
+var (
+	servicesMu sync.RWMutex
+	services   = make(map[string]Service)
+)
+
+// RegisterService makes a backend available by name. It is meant to be called from the
+// init function of the backend and panics if the service is invalid or already registered.
+func RegisterService(service Service) {
+	servicesMu.Lock()
+	defer servicesMu.Unlock()
+	if len(service.Name) == 0 {
+		panic("musicserviceclients: RegisterService service name is empty")
+	}
+	if service.Constructor == nil {
+		panic(fmt.Sprintf("musicserviceclients: RegisterService constructor is nil [service=%s]", service.Name))
+	}
+	if _, dup := services[service.Name]; dup {
+		panic(fmt.Sprintf("musicserviceclients: RegisterService called twice [service=%s]", service.Name))
+	}
+	services[service.Name] = service
+}
+
+func LookupService(name string) (Service, bool) {
+	servicesMu.RLock()
+	defer servicesMu.RUnlock()
+	service, ok := services[name]
+	return service, ok
+}
+
+// Services returns every registered service sorted by name.
+func Services() []Service {
+	servicesMu.RLock()
+	defer servicesMu.RUnlock()
+	var list []Service
+	for _, service := range services {
+		list = append(list, service)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+	return list
+}
+
+// ServicesWith returns the registered services supporting every given capability.
+func ServicesWith(capability Capability) []Service {
+	var list []Service
+	for _, service := range Services() {
+		if service.Capabilities.Has(capability) {
+			list = append(list, service)
+		}
+	}
+	return list
+}
+
+func NewClient(name string, config ServiceConfig) (MediaServiceClient, error) {
+	service, ok := LookupService(name)
+	if !ok {
+		return nil, fmt.Errorf("Unimplemented service %s", name)
+	}
+	return service.Constructor(config)
+}
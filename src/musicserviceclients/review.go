@@ -0,0 +1,35 @@
+package musicserviceclients
+
+type ReviewAction int
+
+const (
+	REVIEW_SKIP ReviewAction = iota
+	REVIEW_PICK
+	REVIEW_QUERY
+)
+
+// ReviewCandidate is a destination track offered to the reviewer with its match score.
+type ReviewCandidate struct {
+	Track Song
+	Score float64
+}
+
+// ReviewDecision picks Candidates[Index], searches again for Query or skips the song.
+type ReviewDecision struct {
+	Action ReviewAction
+	Index  int
+	Query  string
+}
+
+// Reviewer decides the songs the matcher could not: ambiguous matches and songs without an
+// accepted candidate. Candidates are sorted by score. Calls are never concurrent.
+type Reviewer interface {
+	Review(song Song, candidates []ReviewCandidate) (ReviewDecision, error)
+}
+
+// SkipMapping is implemented by track mappings that also remember the songs a reviewer skipped,
+// so they are not asked about again.
+type SkipMapping interface {
+	SkippedTrack(Song) bool
+	RecordSkip(Song)
+}
@@ -0,0 +1,246 @@
+package musicserviceclients
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"musicserviceclients/models"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	SPOTIFY_AUTHORIZE_URL    = "https://accounts.spotify.com/authorize"
+	SPOTIFY_TOKEN_URL        = "https://accounts.spotify.com/api/token"
+	SPOTIFY_REDIRECT_URL     = "http://127.0.0.1:8888/callback"
+	SPOTIFY_LOGIN_TIMEOUT    = 5 * time.Minute
+	SPOTIFY_TOKEN_EXPIRY_GAP = time.Minute
+)
+
+var SPOTIFY_SCOPES = []string{
+	"playlist-read-private",
+	"playlist-read-collaborative",
+	"playlist-modify-public",
+	"playlist-modify-private",
+	"user-read-private",
+	"user-library-read",
+	"user-library-modify",
+	"user-follow-read",
+	"user-follow-modify",
+	"ugc-image-upload",
+}
+
+// SpotifyConfig configures the OAuth authorization code flow with PKCE. Without a ClientId the
+// client falls back to asking for an access token. BaseUrl replaces the Web API endpoint.
+type SpotifyConfig struct {
+	ClientId     string
+	RedirectUrl  string
+	AuthorizeUrl string
+	TokenUrl     string
+	BaseUrl      string
+}
+
+// spotifyAuth holds the tokens of the current session and refreshes the access token with the
+// refresh token when it expires. refreshMu is held across a whole refresh so that concurrent
+// requests redeem the refresh token only once.
+type spotifyAuth struct {
+	config       SpotifyConfig
+	transport    *httpTransport
+	refreshMu    sync.Mutex
+	mu           sync.Mutex
+	accessToken  string
+	refreshToken string
+	expiry       time.Time
+}
+
+type authorizationResult struct {
+	code string
+	err  error
+}
+
+func newSpotifyAuth(config SpotifyConfig, transport *httpTransport) *spotifyAuth {
+	if len(config.RedirectUrl) == 0 {
+		config.RedirectUrl = SPOTIFY_REDIRECT_URL
+	}
+	if len(config.AuthorizeUrl) == 0 {
+		config.AuthorizeUrl = SPOTIFY_AUTHORIZE_URL
+	}
+	if len(config.TokenUrl) == 0 {
+		config.TokenUrl = SPOTIFY_TOKEN_URL
+	}
+	return &spotifyAuth{config: config, transport: transport}
+}
+
+func (a *spotifyAuth) token() string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.accessToken
+}
+
+func (a *spotifyAuth) setAccessToken(accessToken string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.accessToken = accessToken
+}
+
+func (a *spotifyAuth) setRefreshToken(refreshToken string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.refreshToken = refreshToken
+}
+
+func (a *spotifyAuth) currentRefreshToken() string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.refreshToken
+}
+
+func (a *spotifyAuth) canRefresh() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return len(a.refreshToken) > 0 && len(a.config.ClientId) > 0
+}
+
+// authorize runs the authorization code flow with PKCE: the user approves the requested scopes
+// in a browser and Spotify redirects back to a listener on the loopback interface.
+func (a *spotifyAuth) authorize() error {
+	redirectUrl, err := url.Parse(a.config.RedirectUrl)
+	if err != nil {
+		return fmt.Errorf("invalid redirect url [url=%s][err=%v]", a.config.RedirectUrl, err)
+	}
+	verifier, err := randomToken(64)
+	if err != nil {
+		return err
+	}
+	state, err := randomToken(16)
+	if err != nil {
+		return err
+	}
+	listener, err := net.Listen("tcp", redirectUrl.Host)
+	if err != nil {
+		return fmt.Errorf("failed to listen for the redirect [address=%s][err=%v]", redirectUrl.Host, err)
+	}
+	results := make(chan authorizationResult, 1)
+	mux := http.NewServeMux()
+	mux.HandleFunc(redirectUrl.Path, func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		var result authorizationResult
+		switch {
+		case query.Get("state") != state:
+			result.err = errors.New("authorization state mismatch")
+		case len(query.Get("error")) > 0:
+			result.err = fmt.Errorf("authorization denied [err=%s]", query.Get("error"))
+		default:
+			result.code = query.Get("code")
+		}
+		if result.err != nil {
+			http.Error(w, result.err.Error(), http.StatusBadRequest)
+		} else {
+			fmt.Fprintln(w, "Logged in to Spotify. You can close this window.")
+		}
+		select {
+		case results <- result:
+		default:
+		}
+	})
+	server := &http.Server{Handler: mux}
+	go server.Serve(listener)
+	defer server.Shutdown(context.Background())
+
+	challenge := sha256.Sum256([]byte(verifier))
+	query := url.Values{}
+	query.Add("client_id", a.config.ClientId)
+	query.Add("response_type", "code")
+	query.Add("redirect_uri", a.config.RedirectUrl)
+	query.Add("code_challenge_method", "S256")
+	query.Add("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	query.Add("state", state)
+	query.Add("scope", strings.Join(SPOTIFY_SCOPES, " "))
+	log.Printf("\nOpen the following URL in your browser to log in to Spotify:\n%s?%s", a.config.AuthorizeUrl, query.Encode())
+
+	var result authorizationResult
+	select {
+	case result = <-results:
+	case <-time.After(SPOTIFY_LOGIN_TIMEOUT):
+		return errors.New("timed out waiting for the Spotify authorization")
+	}
+	if result.err != nil {
+		return result.err
+	}
+	form := url.Values{}
+	form.Add("grant_type", "authorization_code")
+	form.Add("code", result.code)
+	form.Add("redirect_uri", a.config.RedirectUrl)
+	form.Add("client_id", a.config.ClientId)
+	form.Add("code_verifier", verifier)
+	return a.requestToken(form)
+}
+
+func (a *spotifyAuth) refresh() error {
+	a.mu.Lock()
+	refreshToken := a.refreshToken
+	a.mu.Unlock()
+	form := url.Values{}
+	form.Add("grant_type", "refresh_token")
+	form.Add("refresh_token", refreshToken)
+	form.Add("client_id", a.config.ClientId)
+	err := a.requestToken(form)
+	if err != nil {
+		return fmt.Errorf("failed to refresh access token [err=%v]", err)
+	}
+	return nil
+}
+
+// expired reports whether the access token is about to expire and should be refreshed before
+// the next request.
+func (a *spotifyAuth) expired() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return !a.expiry.IsZero() && time.Now().Add(SPOTIFY_TOKEN_EXPIRY_GAP).After(a.expiry)
+}
+
+func (a *spotifyAuth) requestToken(form url.Values) error {
+	header := http.Header{}
+	header.Add("Content-type", "application/x-www-form-urlencoded")
+	response, err := a.transport.do(http.MethodPost, a.config.TokenUrl, "token", []byte(form.Encode()), header, false)
+	if err != nil {
+		return fmt.Errorf("failed to request token [err=%v]", err)
+	}
+	var token models.SpotifyTokenResponse
+	err = json.Unmarshal([]byte(response), &token)
+	if err != nil {
+		return fmt.Errorf("failed to parse token response [err=%v]", err)
+	}
+	if len(token.AccessToken) == 0 {
+		return errors.New("token response has no access token")
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.accessToken = token.AccessToken
+	if len(token.RefreshToken) > 0 {
+		a.refreshToken = token.RefreshToken
+	}
+	a.expiry = time.Time{}
+	if token.ExpiresIn > 0 {
+		a.expiry = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+	}
+	return nil
+}
+
+func randomToken(size int) (string, error) {
+	buffer := make([]byte, size)
+	_, err := rand.Read(buffer)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate random token [err=%v]", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(buffer), nil
+}
@@ -1,7 +1,8 @@
 package musicserviceclients
 
 import (
-	"bufio"
+	"bytes"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -10,40 +11,80 @@ import (
 	"log"
 	"musicserviceclients/models"
 	"net/http"
-	"os"
+	"net/url"
 	"strings"
+	"time"
 )
 
+const SERVICE_SPOTIFY = "spotify"
+
 const BASE_SPOTIFY_URI = "https://api.spotify.com/v1/"
 
 const (
 	PATH_SPOTIFY_USER            = "me"
 	PATH_SPOTIFY_LIST_PLAYLISTS  = "users/%s/playlists?limit=%d&offset=%d"
-	PATH_SPOTIFY_LIST_PLAYLIST   = "users/%s/playlists/%s/tracks?limit=%d&offset=%d"
-	PATH_SPOTIFY_SEARCH          = ""
-	PATH_SPOTIFY_CREATE_PLAYLIST = ""
-	PATH_SPOTIFY_ADD_TRACK       = ""
+	PATH_SPOTIFY_LIST_PLAYLIST   = "users/%s/playlists/%s/tracks?limit=%d&offset=%d&market=from_token&additional_types=episode"
+	PATH_SPOTIFY_GET_PLAYLIST    = "playlists/%s"
+	PATH_SPOTIFY_SEARCH          = "search?%s"
+	PATH_SPOTIFY_CREATE_PLAYLIST = "users/%s/playlists"
+	PATH_SPOTIFY_ADD_TRACK       = "users/%s/playlists/%s/tracks"
+	PATH_SPOTIFY_REMOVE_TRACK    = "users/%s/playlists/%s/tracks"
+	PATH_SPOTIFY_PLAYLIST_IMAGE  = "playlists/%s/images"
 )
 
+const (
+	CONTENT_TYPE_JSON = "application/json"
+	CONTENT_TYPE_JPEG = "image/jpeg"
+)
+
+// Spotify rejects cover images larger than this, measured before base64 encoding.
+const MAX_SPOTIFY_COVER_IMAGE_BYTES = 256 * 1024
+
+const MAX_SPOTIFY_SEARCH_RESULTS = "10"
+
+const MAX_SPOTIFY_TRACKS_PER_REQUEST = 100
+
+const SPOTIFY_TRACK_URI = "spotify:track:%s"
+
+const SPOTIFY_ISRC_QUERY = "isrc:%s"
+
 type spotifyClient struct {
-	oAuthToken string
-	userId     string
-	client     *http.Client
+	baseUrl     string
+	auth        *spotifyAuth
+	userId      string
+	transport   *httpTransport
+	resolver    *trackResolver
+	credentials CredentialCache
+	provider    CredentialProvider
+	account     string
+	dryRun      bool
+}
+
+func init() {
+	RegisterService(Service{
+		Name:         SERVICE_SPOTIFY,
+		Description:  "Spotify",
+		Constructor:  NewSpotifyClient,
+		Capabilities: CAPABILITY_READ | CAPABILITY_WRITE | CAPABILITY_SEARCH | CAPABILITY_LIBRARY})
 }
 
-func NewSpotifyClient() (MediaServiceClient, error) {
-	client := &http.Client{}
-	return &spotifyClient{client: client}, nil
+func NewSpotifyClient(config ServiceConfig) (MediaServiceClient, error) {
+	client := &spotifyClient{
+		baseUrl:     baseUrl(config.Spotify.BaseUrl, BASE_SPOTIFY_URI),
+		transport:   newHttpTransport(SERVICE_SPOTIFY, httpClient(config), config.RetryPolicy, NewRateLimiter(config.RequestsPerSecond)),
+		credentials: config.Credentials,
+		provider:    credentialProvider(config),
+		account:     config.Account,
+		dryRun:      config.DryRun}
+	client.auth = newSpotifyAuth(config.Spotify, client.transport)
+	client.resolver = newTrackResolver(client, config)
+	return client, nil
 }
 
 func (c *spotifyClient) Login() error {
-	log.Println("\nEnter Spotify OAuth Token.\nYou can retrieve the token at https://developer.spotify.com/web-api/console/get-playlist.\nSelect Scopes[playlist-read-private, playlist-read-collaborative, playlist-modify-public, playlist-modify-collaborative, user-read-private]")
-	scanner := bufio.NewScanner(os.Stdin)
-	if scanner.Scan() {
-		c.oAuthToken = scanner.Text()
-	}
-	if scanner.Err() != nil {
-		return fmt.Errorf("failed to fetch OAuth token [err=%v]", scanner.Err())
+	err := c.authenticate()
+	if err != nil {
+		return err
 	}
 	user, err := c.getCurrentUser()
 	if err != nil {
@@ -51,9 +92,67 @@ func (c *spotifyClient) Login() error {
 	}
 	log.Printf("Welcome to Spotify %s", user.Name)
 	c.userId = user.Id
+	c.saveCredential()
+	return nil
+}
+
+// authenticate reuses a cached refresh token when there is one and otherwise asks the user to
+// log in. Refresh tokens need a client id, without one the user pastes an access token.
+func (c *spotifyClient) authenticate() error {
+	if len(c.auth.config.ClientId) == 0 {
+		prompt := fmt.Sprintf("\nEnter Spotify OAuth Token.\nYou can retrieve the token at https://developer.spotify.com/web-api/console/get-playlist.\nSelect Scopes%v\nConfigure a Spotify client id to log in with your browser instead.\n", SPOTIFY_SCOPES)
+		token, err := c.provider.Credential(CREDENTIAL_SPOTIFY_TOKEN, prompt)
+		if err != nil {
+			return fmt.Errorf("failed to fetch OAuth token [err=%v]", err)
+		}
+		c.auth.setAccessToken(token)
+		return nil
+	}
+	if c.credentials != nil {
+		if credential, ok := c.credentials.Credential(SERVICE_SPOTIFY, c.account); ok {
+			c.auth.setRefreshToken(credential.Secret)
+			err := c.auth.refresh()
+			if err == nil {
+				return nil
+			}
+			log.Printf("Cached Spotify credential was rejected, logging in again [account=%s][err=%v]", credential.Account, err)
+		}
+	}
+	err := c.auth.authorize()
+	if err != nil {
+		return fmt.Errorf("failed to authorize [err=%v]", err)
+	}
+	return nil
+}
+
+// refreshToken refreshes the access token and caches the refresh token, which Spotify may
+// rotate on every refresh. staleToken is the access token the caller sent, when another request
+// already replaced it the new token is reused instead of redeeming the refresh token again.
+func (c *spotifyClient) refreshToken(staleToken string) error {
+	c.auth.refreshMu.Lock()
+	defer c.auth.refreshMu.Unlock()
+	if c.auth.token() != staleToken && !c.auth.expired() {
+		return nil
+	}
+	err := c.auth.refresh()
+	if err != nil {
+		return err
+	}
+	c.saveCredential()
 	return nil
 }
 
+func (c *spotifyClient) saveCredential() {
+	refreshToken := c.auth.currentRefreshToken()
+	if c.credentials == nil || len(c.userId) == 0 || len(refreshToken) == 0 {
+		return
+	}
+	err := c.credentials.SaveCredential(SERVICE_SPOTIFY, Credential{Account: c.userId, Secret: refreshToken})
+	if err != nil {
+		log.Printf("Failed to cache Spotify credential [account=%s][err=%v]", c.userId, err)
+	}
+}
+
 func (c *spotifyClient) ListPlaylist(playListName string) (*Playlist, error) {
 	limit := 50
 	offset := 0
@@ -69,7 +168,7 @@ func (c *spotifyClient) ListPlaylist(playListName string) (*Playlist, error) {
 			return nil, err
 		}
 		for i, spotifyPlaylist := range spotifyPlaylists.Playlists {
-			if spotifyPlaylist.Name == strings.TrimSpace(playListName) {
+			if SamePlaylistName(spotifyPlaylist.Name, playListName) {
 				playlist, err := c.getPlaylist(spotifyPlaylist)
 				if err != nil {
 					return nil, fmt.Errorf("Failed to retrieve playlist info at [offset=%d][name=%s][err=%v]", offset+i, playListName, err)
@@ -78,14 +177,18 @@ func (c *spotifyClient) ListPlaylist(playListName string) (*Playlist, error) {
 			}
 		}
 		offset += limit
-		if spotifyPlaylists.Total < offset {
+		if offset >= spotifyPlaylists.Total {
 			break
 		}
 	}
-	return nil, fmt.Errorf("failed to find playlist with [name=%s]", playListName)
+	return nil, fmt.Errorf("failed to find playlist with [name=%s][err=%w]", playListName, ErrPlaylistNotFound)
 }
 
 func (c *spotifyClient) ListAllPlaylists() ([]Playlist, error) {
+	return c.ListPlaylists(nil)
+}
+
+func (c *spotifyClient) ListPlaylists(filter PlaylistFilter) ([]Playlist, error) {
 	limit := 50
 	offset := 0
 	var playlists []Playlist
@@ -102,6 +205,9 @@ func (c *spotifyClient) ListAllPlaylists() ([]Playlist, error) {
 			return playlists, err
 		}
 		for i, spotifyPlaylist := range spotifyPlaylists.Playlists {
+			if filter != nil && !filter(spotifyPlaylist.Name, spotifyPlaylist.Id) {
+				continue
+			}
 			playlist, err := c.getPlaylist(spotifyPlaylist)
 			if err != nil {
 				return playlists, fmt.Errorf("Failed to retrieve playlist info at [offset=%d][err=%v]", offset+i, err)
@@ -109,39 +215,314 @@ func (c *spotifyClient) ListAllPlaylists() ([]Playlist, error) {
 			playlists = append(playlists, *playlist)
 		}
 		offset += limit
-		if spotifyPlaylists.Total < offset {
+		if offset >= spotifyPlaylists.Total {
 			break
 		}
 	}
 	return playlists, nil
 }
 
-func (c *spotifyClient) CreatePlaylist(playlistName, playListDescription string, songs []Song) error {
-	return errors.New("Unimplemented function")
+func (c *spotifyClient) GetPlaylist(playlistId string) (*Playlist, error) {
+	spotifyPlaylist, err := c.fetchPlaylist(playlistId)
+	if err != nil {
+		return nil, err
+	}
+	return c.getPlaylist(*spotifyPlaylist)
 }
 
-func (c *spotifyClient) makeRequest(method, path string, body io.Reader) (string, error) {
-	req, err := http.NewRequest(method, fmt.Sprintf("%s%s", BASE_SPOTIFY_URI, path), body)
+func (c *spotifyClient) fetchPlaylist(playlistId string) (*models.SpotifyPlaylist, error) {
+	response, err := c.makeRequest(http.MethodGet, fmt.Sprintf(PATH_SPOTIFY_GET_PLAYLIST, url.PathEscape(playlistId)), nil)
+	var httpErr *HttpError
+	if errors.As(err, &httpErr) && httpErr.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("failed to find playlist with [id=%s][err=%w]", playlistId, ErrPlaylistNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch playlist [id=%s][err=%v]", playlistId, err)
+	}
+	dec := json.NewDecoder(strings.NewReader(response))
+	var spotifyPlaylist models.SpotifyPlaylist
+	err = dec.Decode(&spotifyPlaylist)
+	if err != nil {
+		return nil, err
+	}
+	return &spotifyPlaylist, nil
+}
+
+// CreatePlaylist keeps the visibility and cover image of playlist. Spotify only allows private
+// playlists to be collaborative, public ones are created without collaborators.
+func (c *spotifyClient) CreatePlaylist(playlist Playlist) (*PlaylistResult, error) {
+	result := &PlaylistResult{}
+	if !c.dryRun {
+		id, err := c.createNewPlaylist(playlist)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create new empty playlist [name=%s][description=%s][err=%v]", playlist.Name, playlist.Description, err)
+		}
+		result.Id = id
+		if len(playlist.CoverImageUrl) > 0 {
+			err = c.uploadCoverImage(id, playlist.CoverImageUrl)
+			if err != nil {
+				log.Printf("Failed to upload cover image for [name=%s][err=%v]", playlist.Name, err)
+			}
+		}
+	}
+	matches, err := c.addTracksToPlaylist(result.Id, playlist.Songs)
+	result.Matches = matches
+	if err != nil {
+		return result, fmt.Errorf("failed to add the following songs %w", err)
+	}
+	return result, nil
+}
+
+// uploadCoverImage downloads the image at imageUrl and sets it as the cover of the playlist,
+// converting it to a JPEG small enough for Spotify first.
+func (c *spotifyClient) uploadCoverImage(playlistId, imageUrl string) error {
+	content, err := fetchCoverImage(c.transport, imageUrl)
+	if err != nil {
+		return err
+	}
+	content, err = jpegCoverImage(content, MAX_SPOTIFY_COVER_IMAGE_BYTES)
+	if err != nil {
+		return err
+	}
+	encoded := base64.StdEncoding.EncodeToString(content)
+	_, err = c.makeContentRequest(http.MethodPut, fmt.Sprintf(PATH_SPOTIFY_PLAYLIST_IMAGE, url.PathEscape(playlistId)), CONTENT_TYPE_JPEG, strings.NewReader(encoded))
+	if err != nil {
+		return fmt.Errorf("failed to upload cover image [id=%s][err=%v]", playlistId, err)
+	}
+	return nil
+}
+
+func (c *spotifyClient) AddTracks(playlistId string, songs []Song) ([]TrackMatch, error) {
+	return c.addTracksToPlaylist(playlistId, songs)
+}
+
+// RemoveTracks removes one occurrence of the track for every song, starting from the end of the
+// playlist where diffSongs leaves the unpaired duplicates. Without positions Spotify would remove
+// every occurrence of a track, so they are looked up in the current snapshot of the playlist and
+// removed in descending order, which keeps the positions of the remaining batches valid.
+func (c *spotifyClient) RemoveTracks(playlistId string, songs []Song) error {
+	if c.dryRun {
+		return nil
+	}
+	spotifyPlaylist, err := c.fetchPlaylist(playlistId)
+	if err != nil {
+		return err
+	}
+	playlist, err := c.getPlaylist(*spotifyPlaylist)
+	if err != nil {
+		return err
+	}
+	var errorList []error
+	remaining := make(map[string]int)
+	songsById := make(map[string]Song)
+	for _, song := range songs {
+		if len(song.Id) == 0 {
+			errorList = append(errorList, &SongError{Song: song, Reason: REASON_NOT_FOUND, Err: errors.New("failed to remove track without id")})
+		} else {
+			remaining[song.Id]++
+			songsById[song.Id] = song
+		}
+	}
+	var positions []int
+	var removing []Song
+	for i := len(playlist.Songs) - 1; i >= 0; i-- {
+		id := playlist.Songs[i].Id
+		if remaining[id] > 0 {
+			remaining[id]--
+			log.Printf("Removing Track %s\n", playlist.Songs[i].Name)
+			positions = append(positions, i)
+			removing = append(removing, songsById[id])
+		}
+	}
+	for id, count := range remaining {
+		if count > 0 {
+			errorList = append(errorList, &SongError{Song: songsById[id], Reason: REASON_NOT_FOUND, Err: fmt.Errorf("failed to find track in playlist [playlist=%s][track=%s]", playlistId, id)})
+		}
+	}
+	snapshotId := spotifyPlaylist.SnapshotId
+	for start := 0; start < len(positions); start += MAX_SPOTIFY_TRACKS_PER_REQUEST {
+		end := start + MAX_SPOTIFY_TRACKS_PER_REQUEST
+		if end > len(positions) {
+			end = len(positions)
+		}
+		removeTracksRequest := models.SpotifyRemoveTracksRequest{SnapshotId: snapshotId}
+		for i := start; i < end; i++ {
+			removeTracksRequest.Tracks = append(removeTracksRequest.Tracks, models.SpotifyTrackUri{Uri: fmt.Sprintf(SPOTIFY_TRACK_URI, removing[i].Id), Positions: []int{positions[i]}})
+		}
+		jsonRequest, err := json.Marshal(removeTracksRequest)
+		if err != nil {
+			errorList = append(errorList, fmt.Errorf("failed to create json request [err=%v]", err))
+			continue
+		}
+		response, err := c.makeRequest(http.MethodDelete, fmt.Sprintf(PATH_SPOTIFY_REMOVE_TRACK, c.userId, playlistId), bytes.NewReader(jsonRequest))
+		if err != nil {
+			err = fmt.Errorf("failed to remove songs from playlist [id=%s][offset=%d][err=%w]", playlistId, start, err)
+			for _, song := range removing[start:end] {
+				errorList = append(errorList, &SongError{Song: song, Reason: failureReason(err), Err: err})
+			}
+			continue
+		}
+		var removeTracksResponse models.SpotifyRemoveTracksResponse
+		if json.Unmarshal([]byte(response), &removeTracksResponse) == nil && len(removeTracksResponse.SnapshotId) > 0 {
+			snapshotId = removeTracksResponse.SnapshotId
+		}
+	}
+	if len(errorList) == 0 {
+		return nil
+	} else {
+		return newMultiError(errorList)
+	}
+}
+
+func (c *spotifyClient) createNewPlaylist(playlist Playlist) (string, error) {
+	request := &models.SpotifyCreatePlaylistRequest{
+		Name:          playlist.Name,
+		Description:   playlist.Description,
+		Public:        playlist.Public(),
+		Collaborative: playlist.Collaborative && !playlist.Public()}
+	jsonRequest, err := json.Marshal(request)
 	if err != nil {
-		return "", fmt.Errorf("failed to create http request for [path=%s][err=%v]", path, err)
+		return "", fmt.Errorf("failed to create json request [err=%v]", err)
 	}
-	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", c.oAuthToken))
-	response, err := c.client.Do(req)
+	response, err := c.makeRequest(http.MethodPost, fmt.Sprintf(PATH_SPOTIFY_CREATE_PLAYLIST, c.userId), bytes.NewReader(jsonRequest))
 	if err != nil {
-		return "", fmt.Errorf("failed to create http request for [path=%s][err=%v]", path, err)
+		return "", fmt.Errorf("failed to create playlist [name=%s][err=%v]", playlist.Name, err)
 	}
-	result, err := ioutil.ReadAll(response.Body)
-	defer response.Body.Close()
+	dec := json.NewDecoder(strings.NewReader(response))
+	var responseObj models.SpotifyPlaylist
+	err = dec.Decode(&responseObj)
 	if err != nil {
-		return "", fmt.Errorf("failed to create http request for [path=%s][err=%v]", path, err)
+		return "", fmt.Errorf("failed to parse response [response=%s][err=%v]", response, err)
+	}
+	return responseObj.Id, nil
+}
+
+// addTracksToPlaylist matches songs and adds the matched tracks, unless this is a dry run.
+func (c *spotifyClient) addTracksToPlaylist(id string, songs []Song) ([]TrackMatch, error) {
+	matches := c.resolver.resolveAll(songs)
+	indexes, errorList := matchedTracks(matches)
+	if c.dryRun {
+		return matches, nil
+	}
+	var uris []string
+	for _, i := range indexes {
+		log.Printf("Adding Track %s\n", matches[i].Source.Name)
+		uris = append(uris, fmt.Sprintf(SPOTIFY_TRACK_URI, matches[i].Track.Id))
+	}
+	for start := 0; start < len(uris); start += MAX_SPOTIFY_TRACKS_PER_REQUEST {
+		end := start + MAX_SPOTIFY_TRACKS_PER_REQUEST
+		if end > len(uris) {
+			end = len(uris)
+		}
+		addTracksRequest := models.SpotifyAddTracksRequest{Uris: uris[start:end]}
+		jsonRequest, err := json.Marshal(addTracksRequest)
+		if err != nil {
+			errorList = append(errorList, fmt.Errorf("failed to create json request [err=%v]", err))
+			continue
+		}
+		_, err = c.makeRequest(http.MethodPost, fmt.Sprintf(PATH_SPOTIFY_ADD_TRACK, c.userId, id), bytes.NewReader(jsonRequest))
+		if err != nil {
+			err = fmt.Errorf("failed to add songs to playlist [id=%s][offset=%d][err=%w]", id, start, err)
+			for _, i := range indexes[start:end] {
+				errorList = append(errorList, failMatch(&matches[i], failureReason(err), err))
+			}
+		}
 	}
-	if response.StatusCode == http.StatusOK {
-		return string(result), nil
+	if len(errorList) == 0 {
+		return matches, nil
 	} else {
-		return "", fmt.Errorf("failed to make http request for [path=%s][httpstatus=%d][err=%s]", path, response.StatusCode, string(result))
+		return matches, newMultiError(errorList)
 	}
 }
 
+func (c *spotifyClient) searchQueries(song Song) []string {
+	name := strings.Replace(song.Name, "\"", "", -1)
+	if len(song.Artists) == 0 {
+		return []string{fmt.Sprintf("track:\"%s\"", name), name}
+	} else {
+		artist := strings.Replace(song.Artists[0].Name, "\"", "", -1)
+		return []string{fmt.Sprintf("track:\"%s\" artist:\"%s\"", name, artist), fmt.Sprintf("%s %s", artist, name)}
+	}
+}
+
+func (c *spotifyClient) searchIsrc(isrc string) ([]Song, error) {
+	return c.searchTracks(fmt.Sprintf(SPOTIFY_ISRC_QUERY, isrc))
+}
+
+func (c *spotifyClient) searchTracks(searchQuery string) ([]Song, error) {
+	responseObj, err := c.search(searchQuery, "track")
+	if err != nil {
+		return nil, err
+	}
+	var songs []Song
+	for _, track := range responseObj.Tracks.Tracks {
+		songs = append(songs, mediaSong(track))
+	}
+	return songs, nil
+}
+
+// search queries the catalog for items of searchType: track, album or artist.
+func (c *spotifyClient) search(searchQuery, searchType string) (*models.SpotifySearchResponse, error) {
+	query := url.Values{}
+	query.Add("q", searchQuery)
+	query.Add("type", searchType)
+	query.Add("limit", MAX_SPOTIFY_SEARCH_RESULTS)
+	response, err := c.makeRequest(http.MethodGet, fmt.Sprintf(PATH_SPOTIFY_SEARCH, query.Encode()), nil)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(strings.NewReader(response))
+	var responseObj models.SpotifySearchResponse
+	err = dec.Decode(&responseObj)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse response [response=%s][err=%v]", response, err)
+	}
+	return &responseObj, nil
+}
+
+func (c *spotifyClient) makeRequest(method, path string, body io.Reader) (string, error) {
+	return c.makeContentRequest(method, path, CONTENT_TYPE_JSON, body)
+}
+
+func (c *spotifyClient) makeContentRequest(method, path, contentType string, body io.Reader) (string, error) {
+	var requestBody []byte
+	if body != nil {
+		var err error
+		requestBody, err = ioutil.ReadAll(body)
+		if err != nil {
+			return "", fmt.Errorf("failed to create http request for [path=%s][err=%v]", path, err)
+		}
+	}
+	token := c.auth.token()
+	if c.auth.expired() && c.auth.canRefresh() {
+		err := c.refreshToken(token)
+		if err != nil {
+			return "", err
+		}
+		token = c.auth.token()
+	}
+	response, err := c.sendRequest(method, path, contentType, requestBody, token)
+	var httpErr *HttpError
+	if errors.As(err, &httpErr) && httpErr.StatusCode == http.StatusUnauthorized && c.auth.canRefresh() {
+		log.Printf("Refreshing Spotify access token [path=%s]", path)
+		err = c.refreshToken(token)
+		if err != nil {
+			return "", err
+		}
+		response, err = c.sendRequest(method, path, contentType, requestBody, c.auth.token())
+	}
+	return response, err
+}
+
+func (c *spotifyClient) sendRequest(method, path, contentType string, requestBody []byte, token string) (string, error) {
+	header := http.Header{}
+	header.Add("Authorization", fmt.Sprintf("Bearer %s", token))
+	if requestBody != nil {
+		header.Add("Content-type", contentType)
+	}
+	return c.transport.do(method, fmt.Sprintf("%s%s", c.baseUrl, path), path, requestBody, header, idempotentMethod(method))
+}
+
 func (c *spotifyClient) getCurrentUser() (*models.SpotifyUser, error) {
 	response, err := c.makeRequest(http.MethodGet, PATH_SPOTIFY_USER, nil)
 	if err != nil {
@@ -177,7 +558,7 @@ func (c *spotifyClient) getPlaylist(playlist models.SpotifyPlaylist) (*Playlist,
 			mergedSpotifyPlaylistTracks.Tracks = append(mergedSpotifyPlaylistTracks.Tracks, spotifyPlaylistTracks.Tracks...)
 		}
 		offset += limit
-		if mergedSpotifyPlaylistTracks.Total < offset {
+		if offset >= mergedSpotifyPlaylistTracks.Total {
 			break
 		}
 	}
@@ -185,17 +566,73 @@ func (c *spotifyClient) getPlaylist(playlist models.SpotifyPlaylist) (*Playlist,
 }
 
 func mediaPlaylist(spotifyPlaylist models.SpotifyPlaylist, spotifyPlaylistTracks models.SpotifyPlaylistTracks) *Playlist {
-	return &Playlist{Name: spotifyPlaylist.Name, Description: spotifyPlaylist.Description, Id: spotifyPlaylist.Id, Songs: mediaSongs(spotifyPlaylistTracks.Tracks)}
+	playlist := &Playlist{
+		Name:          spotifyPlaylist.Name,
+		Description:   spotifyPlaylist.Description,
+		Id:            spotifyPlaylist.Id,
+		Songs:         mediaSongs(spotifyPlaylistTracks.Tracks),
+		Collaborative: spotifyPlaylist.Collaborative}
+	if spotifyPlaylist.Public != nil {
+		if *spotifyPlaylist.Public {
+			playlist.Visibility = VISIBILITY_PUBLIC
+		} else {
+			playlist.Visibility = VISIBILITY_PRIVATE
+		}
+	}
+	if len(spotifyPlaylist.Images) > 0 {
+		playlist.CoverImageUrl = spotifyPlaylist.Images[0].Url
+	}
+	return playlist
 }
 func mediaSongs(tracks []models.SpotifyTrackWrapper) []Song {
 	var Songs []Song
 	for _, track := range tracks {
-		Songs = append(Songs, mediaSong(track.Track))
+		Songs = append(Songs, mediaItem(track))
 	}
 	return Songs
 }
+
+// mediaItem maps a playlist or library item, marking the ones that are not playable catalog
+// tracks as unmigratable.
+func mediaItem(item models.SpotifyTrackWrapper) Song {
+	if item.Track == nil {
+		return Song{Unmigratable: UNMIGRATABLE_REMOVED}
+	}
+	song := mediaSong(*item.Track)
+	if item.IsLocal || item.Track.IsLocal {
+		song.ServiceIds = nil
+		song.Unmigratable = UNMIGRATABLE_LOCAL_FILE
+	} else if item.Track.Type == models.SPOTIFY_TYPE_EPISODE {
+		song.Unmigratable = UNMIGRATABLE_EPISODE
+	} else if (item.Track.IsPlayable != nil && !*item.Track.IsPlayable) || unplayableRestriction(item.Track.Restrictions) {
+		song.Unmigratable = UNMIGRATABLE_UNAVAILABLE
+	}
+	return song
+}
+
+func unplayableRestriction(restrictions *models.SpotifyRestrictions) bool {
+	if restrictions == nil {
+		return false
+	}
+	return restrictions.Reason == models.SPOTIFY_RESTRICTION_MARKET || restrictions.Reason == models.SPOTIFY_RESTRICTION_PRODUCT
+}
 func mediaSong(track models.SpotifyTrack) Song {
-	return Song{Name: track.Name, Album: mediaAlbum(track.Album), Artists: mediaArtists(track.Artists)}
+	uri := track.Uri
+	if len(uri) == 0 && len(track.Id) > 0 {
+		uri = fmt.Sprintf(SPOTIFY_TRACK_URI, track.Id)
+	}
+	return Song{
+		Name:        track.Name,
+		Album:       mediaAlbum(track.Album),
+		Artists:     mediaArtists(track.Artists),
+		Id:          track.Id,
+		Duration:    time.Duration(track.DurationMs) * time.Millisecond,
+		Isrc:        track.ExternalIds.Isrc,
+		DiscNumber:  track.DiscNumber,
+		TrackNumber: track.TrackNumber,
+		Explicit:    track.Explicit,
+		Year:        releaseYear(track.Album.ReleaseDate),
+		ServiceIds:  serviceIds(SERVICE_SPOTIFY, track.Id, uri)}
 }
 func mediaArtists(artists []models.SpotifyArtist) []Artist {
 	var Artists []Artist
@@ -205,9 +642,9 @@ func mediaArtists(artists []models.SpotifyArtist) []Artist {
 	return Artists
 }
 func mediaArtist(artist models.SpotifyArtist) Artist {
-	return Artist{Name: artist.Name}
+	return Artist{Name: artist.Name, Id: artist.Id}
 }
 
 func mediaAlbum(album models.SpotifyAlbum) Album {
-	return Album{Name: album.Name}
+	return Album{Name: album.Name, Upc: album.ExternalIds.Upc, Id: album.Id, Artists: mediaArtists(album.Artists)}
 }
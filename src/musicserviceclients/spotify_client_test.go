@@ -0,0 +1,350 @@
+package musicserviceclients
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"musicserviceclients/fakes"
+	"musicserviceclients/models"
+	"net/http"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// spotifyPlaylistInput is a playlist and its tracks as Spotify returns them.
+type spotifyPlaylistInput struct {
+	Playlist models.SpotifyPlaylist       `json:"playlist"`
+	Tracks   models.SpotifyPlaylistTracks `json:"tracks"`
+}
+
+func TestMediaPlaylist(t *testing.T) {
+	tests := []string{"full", "empty", "missing_fields", "multiple_artists", "unmigratable"}
+	for _, name := range tests {
+		t.Run(name, func(t *testing.T) {
+			var input spotifyPlaylistInput
+			readTestdata(t, fmt.Sprintf("spotify/playlist_%s.json", name), &input)
+			playlist := mediaPlaylist(input.Playlist, input.Tracks)
+			assertGolden(t, fmt.Sprintf("spotify/playlist_%s.golden.json", name), playlist)
+		})
+	}
+}
+
+func TestMediaArtists(t *testing.T) {
+	tests := []struct {
+		name     string
+		artists  []models.SpotifyArtist
+		expected []Artist
+	}{
+		{"nil", nil, nil},
+		{"empty", []models.SpotifyArtist{}, nil},
+		{"single", []models.SpotifyArtist{{Name: "The Killers", Id: "0C0XlULifJtAgn6ZNCW2eu"}}, []Artist{{Name: "The Killers", Id: "0C0XlULifJtAgn6ZNCW2eu"}}},
+		{"ordered", []models.SpotifyArtist{{Name: "Daft Punk", Id: "a"}, {Name: "Pharrell Williams", Id: "b"}}, []Artist{{Name: "Daft Punk", Id: "a"}, {Name: "Pharrell Williams", Id: "b"}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actual := mediaArtists(test.artists)
+			if !reflect.DeepEqual(actual, test.expected) {
+				t.Errorf("mediaArtists() = %+v, want %+v", actual, test.expected)
+			}
+		})
+	}
+}
+
+func TestMediaSongs(t *testing.T) {
+	var input spotifyPlaylistInput
+	readTestdata(t, "spotify/playlist_full.json", &input)
+	songs := mediaSongs(input.Tracks.Tracks)
+	if len(songs) != len(input.Tracks.Tracks) {
+		t.Fatalf("mediaSongs() returned %d songs, want %d", len(songs), len(input.Tracks.Tracks))
+	}
+	for i, song := range songs {
+		if song.Id != input.Tracks.Tracks[i].Track.Id {
+			t.Errorf("song %d has id %s, want %s", i, song.Id, input.Tracks.Tracks[i].Track.Id)
+		}
+	}
+	if songs := mediaSongs(nil); songs != nil {
+		t.Errorf("mediaSongs(nil) = %+v, want nil", songs)
+	}
+}
+
+func TestGetPlaylistPaging(t *testing.T) {
+	tests := []struct {
+		total    int
+		requests int
+	}{
+		{0, 1},
+		{1, 1},
+		{99, 1},
+		{100, 1},
+		{101, 2},
+		{250, 3},
+	}
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("total=%d", test.total), func(t *testing.T) {
+			var fixtures []fakes.Fixture
+			for offset := 0; offset < test.total || offset == 0; offset += 100 {
+				fixtures = append(fixtures, fakes.Fixture{
+					Method:   http.MethodGet,
+					Path:     fmt.Sprintf("/v1/users/owner/playlists/playlist/tracks?offset=%d", offset),
+					Response: trackPage(offset, 100, test.total)})
+			}
+			server := fakes.NewServer(fixtures)
+			defer server.Close()
+			client := newFakeSpotifyClient(t, server)
+
+			playlist, err := client.getPlaylist(models.SpotifyPlaylist{Id: "playlist", Name: "Paged", Owner: models.SpotifyPlaylistsOwner{Id: "owner"}})
+			if err != nil {
+				t.Fatalf("getPlaylist() failed [err=%v]", err)
+			}
+			if len(playlist.Songs) != test.total {
+				t.Errorf("getPlaylist() returned %d songs, want %d", len(playlist.Songs), test.total)
+			}
+			for i, song := range playlist.Songs {
+				if song.Id != fmt.Sprintf("track%d", i) {
+					t.Errorf("song %d has id %s, want track%d", i, song.Id, i)
+					break
+				}
+			}
+			assertRequests(t, server, test.requests)
+		})
+	}
+}
+
+func TestListPlaylistsPaging(t *testing.T) {
+	tests := []struct {
+		total    int
+		requests int
+	}{
+		{0, 1},
+		{49, 1},
+		{50, 1},
+		{51, 2},
+		{120, 3},
+	}
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("total=%d", test.total), func(t *testing.T) {
+			var fixtures []fakes.Fixture
+			for offset := 0; offset < test.total || offset == 0; offset += 50 {
+				fixtures = append(fixtures, fakes.Fixture{
+					Method:   http.MethodGet,
+					Path:     fmt.Sprintf("/v1/users/owner/playlists?offset=%d", offset),
+					Response: playlistPage(offset, 50, test.total)})
+			}
+			server := fakes.NewServer(fixtures)
+			defer server.Close()
+			client := newFakeSpotifyClient(t, server)
+
+			listed := 0
+			playlists, err := client.ListPlaylists(func(name, id string) bool {
+				listed++
+				return false
+			})
+			if err != nil {
+				t.Fatalf("ListPlaylists() failed [err=%v]", err)
+			}
+			if len(playlists) != 0 || listed != test.total {
+				t.Errorf("ListPlaylists() filtered %d playlists and returned %d, want %d and 0", listed, len(playlists), test.total)
+			}
+			assertRequests(t, server, test.requests)
+
+			_, err = client.ListPlaylist("missing")
+			if err == nil {
+				t.Errorf("ListPlaylist() found a playlist that does not exist")
+			}
+		})
+	}
+}
+
+func newFakeSpotifyClient(t *testing.T, server *fakes.Server) *spotifyClient {
+	t.Helper()
+	client, err := NewSpotifyClient(ServiceConfig{
+		Spotify:     SpotifyConfig{BaseUrl: server.SpotifyBaseUrl()},
+		RetryPolicy: RetryPolicy{MaxRetries: -1}})
+	if err != nil {
+		t.Fatalf("failed to create client [err=%v]", err)
+	}
+	spotify := client.(*spotifyClient)
+	spotify.userId = "owner"
+	return spotify
+}
+
+// assertRequests checks that the client sent exactly the expected number of requests and that
+// every one of them was answered by a fixture.
+func assertRequests(t *testing.T, server *fakes.Server, expected int) {
+	t.Helper()
+	if requests := server.Requests(); len(requests) != expected {
+		t.Errorf("sent %d requests, want %d", len(requests), expected)
+	}
+	for _, request := range server.Unmatched() {
+		t.Errorf("unexpected request [method=%s][path=%s][query=%s]", request.Method, request.Path, request.Query.Encode())
+	}
+}
+
+func trackPage(offset, limit, total int) []byte {
+	items := "["
+	for i := offset; i < offset+limit && i < total; i++ {
+		if i > offset {
+			items += ","
+		}
+		items += fmt.Sprintf(`{"track":{"name":"Track %d","id":"track%d","duration_ms":1000}}`, i, i)
+	}
+	items += "]"
+	return []byte(fmt.Sprintf(`{"items":%s,"limit":%d,"offset":%d,"total":%d}`, items, limit, offset, total))
+}
+
+func playlistPage(offset, limit, total int) []byte {
+	items := "["
+	for i := offset; i < offset+limit && i < total; i++ {
+		if i > offset {
+			items += ","
+		}
+		items += fmt.Sprintf(`{"name":"Playlist %d","id":"playlist%d","owner":{"id":"owner"}}`, i, i)
+	}
+	items += "]"
+	return []byte(fmt.Sprintf(`{"items":%s,"limit":%d,"offset":%d,"total":%d}`, items, limit, offset, total))
+}
+
+func TestReleaseYear(t *testing.T) {
+	tests := []struct {
+		date     string
+		expected int
+	}{
+		{"1977", 1977},
+		{"2013-05", 2013},
+		{"2004-06-07", 2004},
+		{"", 0},
+		{"77", 0},
+		{"unknown", 0},
+	}
+	for _, test := range tests {
+		if actual := releaseYear(test.date); actual != test.expected {
+			t.Errorf("releaseYear(%q) = %d, want %d", test.date, actual, test.expected)
+		}
+	}
+}
+
+func TestCreatePlaylistMetadata(t *testing.T) {
+	tests := []struct {
+		name     string
+		playlist Playlist
+		request  string
+	}{
+		{"unknown visibility is private", Playlist{Name: "Unknown"},
+			`{"name":"Unknown","description":"","public":false,"collaborative":false}`},
+		{"private collaborative", Playlist{Name: "Shared", Visibility: VISIBILITY_PRIVATE, Collaborative: true},
+			`{"name":"Shared","description":"","public":false,"collaborative":true}`},
+		{"public drops collaborative", Playlist{Name: "Open", Description: "For everyone", Visibility: VISIBILITY_PUBLIC, Collaborative: true},
+			`{"name":"Open","description":"For everyone","public":true,"collaborative":false}`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := fakes.NewServer([]fakes.Fixture{{
+				Method:   http.MethodPost,
+				Path:     "/v1/users/owner/playlists",
+				Request:  []byte(test.request),
+				Status:   http.StatusCreated,
+				Response: []byte(`{"id":"created"}`)}})
+			defer server.Close()
+			client := newFakeSpotifyClient(t, server)
+
+			result, err := client.CreatePlaylist(test.playlist)
+			if err != nil {
+				t.Fatalf("CreatePlaylist() failed [err=%v]", err)
+			}
+			if result.Id != "created" {
+				t.Errorf("CreatePlaylist() returned id %s, want created", result.Id)
+			}
+			assertRequests(t, server, 1)
+		})
+	}
+}
+
+func TestCreatePlaylistCoverImage(t *testing.T) {
+	cover := encodeTestImage(t, "png", 32, 32)
+	server := fakes.NewServer([]fakes.Fixture{
+		{Method: http.MethodPost, Path: "/v1/users/owner/playlists", Status: http.StatusCreated, Response: []byte(`{"id":"created"}`)},
+		{Method: http.MethodGet, Path: "/covers/road-trip.png", Response: cover},
+		{Method: http.MethodPut, Path: "/v1/playlists/created/images", Status: http.StatusAccepted}})
+	defer server.Close()
+	client := newFakeSpotifyClient(t, server)
+
+	_, err := client.CreatePlaylist(Playlist{Name: "Road Trip", CoverImageUrl: server.URL + "/covers/road-trip.png"})
+	if err != nil {
+		t.Fatalf("CreatePlaylist() failed [err=%v]", err)
+	}
+	assertRequests(t, server, 3)
+	upload := server.Requests()[2]
+	content, err := base64.StdEncoding.DecodeString(string(upload.Body))
+	if err != nil {
+		t.Fatalf("cover image is not base64 encoded [err=%v]", err)
+	}
+	if _, format, err := image.DecodeConfig(bytes.NewReader(content)); err != nil || format != IMAGE_FORMAT_JPEG {
+		t.Errorf("uploaded a %s cover image [err=%v], want jpeg", format, err)
+	}
+}
+
+func TestConcurrentRequestsRefreshOnce(t *testing.T) {
+	server := fakes.NewServer([]fakes.Fixture{
+		{Method: http.MethodPost, Path: "/api/token", Response: []byte(`{"access_token":"fresh","refresh_token":"rotated","expires_in":3600}`)},
+		{Method: http.MethodGet, Path: "/v1/me", Response: []byte(`{"id":"owner"}`)}})
+	defer server.Close()
+	client, err := NewSpotifyClient(ServiceConfig{
+		Spotify:     SpotifyConfig{ClientId: "client", BaseUrl: server.SpotifyBaseUrl(), TokenUrl: server.SpotifyTokenUrl()},
+		RetryPolicy: RetryPolicy{MaxRetries: -1}})
+	if err != nil {
+		t.Fatalf("failed to create client [err=%v]", err)
+	}
+	spotify := client.(*spotifyClient)
+	spotify.auth.accessToken = "expired"
+	spotify.auth.refreshToken = "refresh"
+	spotify.auth.expiry = time.Now().Add(-time.Minute)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := spotify.getCurrentUser(); err != nil {
+				t.Errorf("getCurrentUser() failed [err=%v]", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	refreshes := 0
+	for _, request := range server.Requests() {
+		if request.Path == "/api/token" {
+			refreshes++
+		}
+	}
+	if refreshes != 1 {
+		t.Errorf("refreshed the token %d times, want 1", refreshes)
+	}
+	if token := spotify.auth.token(); token != "fresh" {
+		t.Errorf("access token is %s, want fresh", token)
+	}
+	assertRequests(t, server, 9)
+}
+
+func TestRemoveTracksPositions(t *testing.T) {
+	items := `{"items":[` +
+		`{"track":{"name":"A","id":"a"}},{"track":{"name":"B","id":"b"}},` +
+		`{"track":{"name":"A","id":"a"}},{"track":{"name":"C","id":"c"}}],"limit":100,"offset":0,"total":4}`
+	server := fakes.NewServer([]fakes.Fixture{
+		{Method: http.MethodGet, Path: "/v1/playlists/mix", Response: []byte(`{"id":"mix","name":"Mix","owner":{"id":"owner"},"snapshot_id":"snapshot1"}`)},
+		{Method: http.MethodGet, Path: "/v1/users/owner/playlists/mix/tracks?offset=0", Response: []byte(items)},
+		{Method: http.MethodDelete, Path: "/v1/users/owner/playlists/mix/tracks",
+			Request:  []byte(`{"tracks":[{"uri":"spotify:track:c","positions":[3]},{"uri":"spotify:track:a","positions":[2]}],"snapshot_id":"snapshot1"}`),
+			Response: []byte(`{"snapshot_id":"snapshot2"}`)}})
+	defer server.Close()
+	client := newFakeSpotifyClient(t, server)
+
+	err := client.RemoveTracks("mix", []Song{{Name: "A", Id: "a"}, {Name: "C", Id: "c"}})
+	if err != nil {
+		t.Fatalf("RemoveTracks() failed [err=%v]", err)
+	}
+	assertRequests(t, server, 3)
+}
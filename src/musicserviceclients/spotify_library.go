@@ -0,0 +1,241 @@
+package musicserviceclients
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"musicserviceclients/models"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	PATH_SPOTIFY_SAVED_TRACKS     = "me/tracks?limit=%d&offset=%d&market=from_token"
+	PATH_SPOTIFY_SAVED_ALBUMS     = "me/albums?limit=%d&offset=%d"
+	PATH_SPOTIFY_FOLLOWED_ARTISTS = "me/following?type=artist&limit=%d"
+	PATH_SPOTIFY_SAVE_TRACKS      = "me/tracks"
+	PATH_SPOTIFY_SAVE_ALBUMS      = "me/albums"
+	PATH_SPOTIFY_FOLLOW_ARTISTS   = "me/following?type=artist"
+)
+
+const (
+	MAX_SPOTIFY_SAVED_TRACKS_PER_REQUEST     = 50
+	MAX_SPOTIFY_SAVED_ALBUMS_PER_REQUEST     = 20
+	MAX_SPOTIFY_FOLLOWED_ARTISTS_PER_REQUEST = 50
+)
+
+const SPOTIFY_UPC_QUERY = "upc:%s"
+
+func (c *spotifyClient) ListSavedTracks() ([]Song, error) {
+	limit := 50
+	offset := 0
+	var songs []Song
+	for {
+		response, err := c.makeRequest(http.MethodGet, fmt.Sprintf(PATH_SPOTIFY_SAVED_TRACKS, limit, offset), nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list saved tracks [offset=%d][err=%v]", offset, err)
+		}
+		dec := json.NewDecoder(strings.NewReader(response))
+		var savedTracks models.SpotifySavedTracks
+		err = dec.Decode(&savedTracks)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse response [response=%s][err=%v]", response, err)
+		}
+		songs = append(songs, mediaSongs(savedTracks.Tracks)...)
+		offset += limit
+		if offset >= savedTracks.Total {
+			break
+		}
+	}
+	return songs, nil
+}
+
+func (c *spotifyClient) ListSavedAlbums() ([]Album, error) {
+	limit := 50
+	offset := 0
+	var albums []Album
+	for {
+		response, err := c.makeRequest(http.MethodGet, fmt.Sprintf(PATH_SPOTIFY_SAVED_ALBUMS, limit, offset), nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list saved albums [offset=%d][err=%v]", offset, err)
+		}
+		dec := json.NewDecoder(strings.NewReader(response))
+		var savedAlbums models.SpotifySavedAlbums
+		err = dec.Decode(&savedAlbums)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse response [response=%s][err=%v]", response, err)
+		}
+		for _, savedAlbum := range savedAlbums.Albums {
+			albums = append(albums, mediaAlbum(savedAlbum.Album))
+		}
+		offset += limit
+		if offset >= savedAlbums.Total {
+			break
+		}
+	}
+	return albums, nil
+}
+
+// ListFollowedArtists pages through the followed artists with the cursor Spotify returns
+// instead of an offset.
+func (c *spotifyClient) ListFollowedArtists() ([]Artist, error) {
+	limit := 50
+	after := ""
+	var artists []Artist
+	for {
+		path := fmt.Sprintf(PATH_SPOTIFY_FOLLOWED_ARTISTS, limit)
+		if len(after) > 0 {
+			path = fmt.Sprintf("%s&after=%s", path, url.QueryEscape(after))
+		}
+		response, err := c.makeRequest(http.MethodGet, path, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list followed artists [after=%s][err=%v]", after, err)
+		}
+		dec := json.NewDecoder(strings.NewReader(response))
+		var followedArtists models.SpotifyFollowedArtists
+		err = dec.Decode(&followedArtists)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse response [response=%s][err=%v]", response, err)
+		}
+		artists = append(artists, mediaArtists(followedArtists.Artists.Artists)...)
+		after = followedArtists.Artists.Cursors.After
+		if len(followedArtists.Artists.Next) == 0 || len(after) == 0 {
+			break
+		}
+	}
+	return artists, nil
+}
+
+// SaveTracks matches songs and saves the matched tracks, unless this is a dry run.
+func (c *spotifyClient) SaveTracks(songs []Song) ([]TrackMatch, error) {
+	matches := c.resolver.resolveAll(songs)
+	indexes, errorList := matchedTracks(matches)
+	if c.dryRun {
+		return matches, nil
+	}
+	var ids []string
+	for _, i := range indexes {
+		log.Printf("Saving Track %s\n", matches[i].Source.Name)
+		ids = append(ids, matches[i].Track.Id)
+	}
+	for start := 0; start < len(ids); start += MAX_SPOTIFY_SAVED_TRACKS_PER_REQUEST {
+		end := start + MAX_SPOTIFY_SAVED_TRACKS_PER_REQUEST
+		if end > len(ids) {
+			end = len(ids)
+		}
+		err := c.putIds(PATH_SPOTIFY_SAVE_TRACKS, ids[start:end])
+		if err != nil {
+			err = fmt.Errorf("failed to save tracks [offset=%d][err=%w]", start, err)
+			for _, i := range indexes[start:end] {
+				errorList = append(errorList, failMatch(&matches[i], failureReason(err), err))
+			}
+		}
+	}
+	if len(errorList) == 0 {
+		return matches, nil
+	} else {
+		return matches, newMultiError(errorList)
+	}
+}
+
+// SaveAlbums matches albums and saves the matched ones, unless this is a dry run.
+func (c *spotifyClient) SaveAlbums(albums []Album) ([]Album, error) {
+	resolved, errorList := c.resolver.resolveAlbums(c, albums)
+	if c.dryRun {
+		return resolved, newMultiError(errorList)
+	}
+	var saved []Album
+	for start := 0; start < len(resolved); start += MAX_SPOTIFY_SAVED_ALBUMS_PER_REQUEST {
+		end := start + MAX_SPOTIFY_SAVED_ALBUMS_PER_REQUEST
+		if end > len(resolved) {
+			end = len(resolved)
+		}
+		var ids []string
+		for _, album := range resolved[start:end] {
+			log.Printf("Saving Album %s\n", album.Name)
+			ids = append(ids, album.Id)
+		}
+		err := c.putIds(PATH_SPOTIFY_SAVE_ALBUMS, ids)
+		if err != nil {
+			errorList = append(errorList, fmt.Errorf("failed to save albums [offset=%d][err=%w]", start, err))
+		} else {
+			saved = append(saved, resolved[start:end]...)
+		}
+	}
+	return saved, newMultiError(errorList)
+}
+
+// FollowArtists matches artists and follows the matched ones, unless this is a dry run.
+func (c *spotifyClient) FollowArtists(artists []Artist) ([]Artist, error) {
+	resolved, errorList := c.resolver.resolveArtists(c, artists)
+	if c.dryRun {
+		return resolved, newMultiError(errorList)
+	}
+	var followed []Artist
+	for start := 0; start < len(resolved); start += MAX_SPOTIFY_FOLLOWED_ARTISTS_PER_REQUEST {
+		end := start + MAX_SPOTIFY_FOLLOWED_ARTISTS_PER_REQUEST
+		if end > len(resolved) {
+			end = len(resolved)
+		}
+		var ids []string
+		for _, artist := range resolved[start:end] {
+			log.Printf("Following Artist %s\n", artist.Name)
+			ids = append(ids, artist.Id)
+		}
+		err := c.putIds(PATH_SPOTIFY_FOLLOW_ARTISTS, ids)
+		if err != nil {
+			errorList = append(errorList, fmt.Errorf("failed to follow artists [offset=%d][err=%w]", start, err))
+		} else {
+			followed = append(followed, resolved[start:end]...)
+		}
+	}
+	return followed, newMultiError(errorList)
+}
+
+func (c *spotifyClient) putIds(path string, ids []string) error {
+	jsonRequest, err := json.Marshal(models.SpotifyIdsRequest{Ids: ids})
+	if err != nil {
+		return fmt.Errorf("failed to create json request [err=%v]", err)
+	}
+	_, err = c.makeRequest(http.MethodPut, path, bytes.NewReader(jsonRequest))
+	return err
+}
+
+// searchAlbums looks the album up by UPC first, as the same album is often listed under a
+// slightly different name.
+func (c *spotifyClient) searchAlbums(album Album) ([]Album, error) {
+	name := strings.Replace(album.Name, "\"", "", -1)
+	queries := []string{fmt.Sprintf("album:\"%s\"", name)}
+	if len(album.Artists) > 0 {
+		artist := strings.Replace(album.Artists[0].Name, "\"", "", -1)
+		queries = []string{fmt.Sprintf("album:\"%s\" artist:\"%s\"", name, artist), fmt.Sprintf("%s %s", artist, name)}
+	}
+	if len(album.Upc) > 0 {
+		queries = append([]string{fmt.Sprintf(SPOTIFY_UPC_QUERY, album.Upc)}, queries...)
+	}
+	var albums []Album
+	for _, query := range queries {
+		responseObj, err := c.search(query, "album")
+		if err != nil {
+			return nil, err
+		}
+		for _, spotifyAlbum := range responseObj.Albums.Albums {
+			albums = append(albums, mediaAlbum(spotifyAlbum))
+		}
+		if len(albums) > 0 {
+			break
+		}
+	}
+	return albums, nil
+}
+
+func (c *spotifyClient) searchArtists(artist Artist) ([]Artist, error) {
+	name := strings.Replace(artist.Name, "\"", "", -1)
+	responseObj, err := c.search(fmt.Sprintf("artist:\"%s\"", name), "artist")
+	if err != nil {
+		return nil, err
+	}
+	return mediaArtists(responseObj.Artists.Artists), nil
+}
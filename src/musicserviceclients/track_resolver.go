@@ -0,0 +1,261 @@
+package musicserviceclients
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"musicserviceclients/matcher"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// trackSearcher is implemented by destination clients that can search their catalog. The
+// returned songs carry the destination track id in Id.
+type trackSearcher interface {
+	searchQueries(song Song) []string
+	searchTracks(query string) ([]Song, error)
+}
+
+// isrcSearcher is implemented by destination clients that can look tracks up by ISRC.
+type isrcSearcher interface {
+	searchIsrc(isrc string) ([]Song, error)
+}
+
+// trackResolver finds the destination track for a source song, reusing the recorded mapping
+// when there is one, then trying an exact ISRC lookup and otherwise scoring the search results
+// of every query in turn.
+type trackResolver struct {
+	searcher trackSearcher
+	matcher  *matcher.Matcher
+	mapping  TrackMapping
+	workers  int
+	reviewer Reviewer
+	reviewMu sync.Mutex
+}
+
+func newTrackResolver(searcher trackSearcher, config ServiceConfig) *trackResolver {
+	trackMatcher := config.Matcher
+	if trackMatcher == nil {
+		trackMatcher = matcher.NewMatcher(matcher.DEFAULT_THRESHOLD)
+	}
+	workers := config.Workers
+	if workers <= 0 {
+		workers = DEFAULT_WORKERS
+	}
+	return &trackResolver{
+		searcher: searcher,
+		matcher:  trackMatcher,
+		mapping:  config.TrackMapping,
+		workers:  workers,
+		reviewer: config.Reviewer}
+}
+
+// resolveAll resolves songs on a pool of workers and returns their matches in the order of
+// songs.
+func (r *trackResolver) resolveAll(songs []Song) []TrackMatch {
+	matches := make([]TrackMatch, len(songs))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < r.workers && w < len(songs); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				matches[i] = r.resolve(songs[i])
+			}
+		}()
+	}
+	for i := range songs {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+	return matches
+}
+
+func (r *trackResolver) resolve(song Song) TrackMatch {
+	if r.mapping != nil {
+		if id, ok := r.mapping.DestinationTrack(song); ok {
+			return TrackMatch{Source: song, Track: &Song{Id: id}, Score: 1, Status: MATCH_MATCHED, Mapped: true}
+		}
+		if skips, ok := r.mapping.(SkipMapping); ok && skips.SkippedTrack(song) {
+			return skippedMatch(song)
+		}
+	}
+	source := MatchTrack(song)
+	if resolved := r.resolveIsrc(song, source); resolved != nil {
+		return TrackMatch{Source: song, Track: resolved, Score: 1, Status: MATCH_MATCHED}
+	}
+	var reviewCandidates []ReviewCandidate
+	for _, query := range r.searcher.searchQueries(song) {
+		candidates, err := r.search(source, query)
+		if err != nil {
+			return TrackMatch{Source: song, Status: MATCH_FAILED, Err: &SongError{Song: song, Reason: REASON_HTTP_ERROR, Err: err}}
+		}
+		reviewCandidates = mergeCandidates(reviewCandidates, candidates)
+		if len(candidates) > 0 && candidates[0].Score >= r.matcher.Threshold {
+			resolved := candidates[0].Track
+			status := MATCH_MATCHED
+			if len(candidates) > 1 && r.matcher.Ambiguous(candidates[0].Score, candidates[1].Score) && candidates[1].Track.Id != resolved.Id {
+				status = MATCH_AMBIGUOUS
+			}
+			if status == MATCH_AMBIGUOUS && r.reviewer != nil {
+				return r.review(song, source, candidates)
+			}
+			if r.mapping != nil {
+				r.mapping.RecordTrack(song, resolved.Id)
+			}
+			return TrackMatch{Source: song, Track: &resolved, Score: candidates[0].Score, Status: status}
+		}
+	}
+	if r.reviewer != nil {
+		return r.review(song, source, reviewCandidates)
+	}
+	return TrackMatch{Source: song, Status: MATCH_NOT_FOUND, Err: &SongError{Song: song, Reason: REASON_NOT_FOUND, Err: errors.New("failed to find a match")}}
+}
+
+// search returns the results of query ranked against source.
+func (r *trackResolver) search(source matcher.Track, query string) ([]ReviewCandidate, error) {
+	results, err := r.searcher.searchTracks(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search request [query=%s][err=%w]", query, err)
+	}
+	var tracks []matcher.Track
+	for _, result := range results {
+		tracks = append(tracks, MatchTrack(result))
+	}
+	var candidates []ReviewCandidate
+	for _, ranked := range r.matcher.Rank(source, tracks) {
+		candidates = append(candidates, ReviewCandidate{Track: results[ranked.Index], Score: ranked.Score})
+	}
+	return candidates, nil
+}
+
+// review asks the reviewer until it picks a candidate or skips the song, and remembers the
+// decision in the mapping.
+func (r *trackResolver) review(song Song, source matcher.Track, candidates []ReviewCandidate) TrackMatch {
+	r.reviewMu.Lock()
+	defer r.reviewMu.Unlock()
+	for {
+		decision, err := r.reviewer.Review(song, candidates)
+		if err != nil {
+			return TrackMatch{Source: song, Status: MATCH_FAILED, Err: &SongError{Song: song, Reason: REASON_NOT_FOUND, Err: fmt.Errorf("failed to review match [err=%v]", err)}}
+		}
+		switch decision.Action {
+		case REVIEW_PICK:
+			if decision.Index < 0 || decision.Index >= len(candidates) {
+				return TrackMatch{Source: song, Status: MATCH_FAILED, Err: &SongError{Song: song, Reason: REASON_NOT_FOUND, Err: fmt.Errorf("invalid review choice [index=%d]", decision.Index)}}
+			}
+			picked := candidates[decision.Index]
+			if r.mapping != nil {
+				r.mapping.RecordTrack(song, picked.Track.Id)
+			}
+			return TrackMatch{Source: song, Track: &picked.Track, Score: picked.Score, Status: MATCH_MATCHED}
+		case REVIEW_QUERY:
+			searched, err := r.search(source, decision.Query)
+			if err != nil {
+				log.Printf("Failed to search, keeping the previous candidates [song=%s][err=%v]", song.Name, err)
+			} else {
+				candidates = searched
+			}
+		default:
+			if skips, ok := r.mapping.(SkipMapping); ok {
+				skips.RecordSkip(song)
+			}
+			return skippedMatch(song)
+		}
+	}
+}
+
+func skippedMatch(song Song) TrackMatch {
+	return TrackMatch{Source: song, Status: MATCH_NOT_FOUND, Err: &SongError{Song: song, Reason: REASON_NOT_FOUND, Err: errors.New("skipped during review")}}
+}
+
+// mergeCandidates adds the candidates of another query, keeping the higher score of tracks
+// found by both, and sorts them by score.
+func mergeCandidates(candidates, more []ReviewCandidate) []ReviewCandidate {
+	positions := make(map[string]int)
+	for i, candidate := range candidates {
+		positions[candidate.Track.Id] = i
+	}
+	for _, candidate := range more {
+		if i, ok := positions[candidate.Track.Id]; ok {
+			if candidate.Score > candidates[i].Score {
+				candidates[i] = candidate
+			}
+			continue
+		}
+		positions[candidate.Track.Id] = len(candidates)
+		candidates = append(candidates, candidate)
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Score > candidates[j].Score
+	})
+	return candidates
+}
+
+// resolveIsrc returns nil when the lookup is unsupported, fails or finds nothing, so that
+// resolve falls back to the text search. Several releases can share an ISRC, so they are
+// ranked on their remaining metadata and the best one is kept.
+func (r *trackResolver) resolveIsrc(song Song, source matcher.Track) *Song {
+	searcher, ok := r.searcher.(isrcSearcher)
+	if !ok || len(song.Isrc) == 0 {
+		return nil
+	}
+	candidates, err := searcher.searchIsrc(song.Isrc)
+	if err != nil {
+		log.Printf("Failed to look up isrc, falling back to search [song=%s][isrc=%s][err=%v]", song.Name, song.Isrc, err)
+		return nil
+	}
+	var tracks []matcher.Track
+	for _, candidate := range candidates {
+		track := MatchTrack(candidate)
+		track.Isrc = ""
+		tracks = append(tracks, track)
+	}
+	source.Isrc = ""
+	ranked := r.matcher.Rank(source, tracks)
+	for _, candidate := range ranked {
+		if strings.EqualFold(candidates[candidate.Index].Isrc, song.Isrc) {
+			resolved := candidates[candidate.Index]
+			if r.mapping != nil {
+				r.mapping.RecordTrack(song, resolved.Id)
+			}
+			return &resolved
+		}
+	}
+	return nil
+}
+
+// matchedTracks returns the indexes of the matches to add and the errors of the songs that were
+// not matched.
+func matchedTracks(matches []TrackMatch) ([]int, []error) {
+	var indexes []int
+	var errorList []error
+	for i, match := range matches {
+		if match.Track != nil {
+			indexes = append(indexes, i)
+		} else if match.Err != nil {
+			errorList = append(errorList, match.Err)
+		}
+	}
+	return indexes, errorList
+}
+
+// failMatch marks a matched song the destination did not add and returns its error.
+func failMatch(match *TrackMatch, reason FailureReason, err error) error {
+	songErr := &SongError{Song: match.Source, Reason: reason, Err: err}
+	match.Status = MATCH_FAILED
+	match.Err = songErr
+	return songErr
+}
+
+// MatchTrack returns the metadata of song the matcher compares.
+func MatchTrack(song Song) matcher.Track {
+	track := matcher.Track{Title: song.Name, Album: song.Album.Name, Duration: song.Duration, Isrc: song.Isrc}
+	for _, artist := range song.Artists {
+		track.Artists = append(track.Artists, artist.Name)
+	}
+	return track
+}
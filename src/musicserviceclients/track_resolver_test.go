@@ -0,0 +1,65 @@
+package musicserviceclients
+
+import (
+	"reflect"
+	"testing"
+)
+
+// fakeSearcher returns the same results for every query and counts the searches.
+type fakeSearcher struct {
+	results  []Song
+	searches int
+}
+
+func (s *fakeSearcher) searchQueries(song Song) []string {
+	return []string{song.Name}
+}
+
+func (s *fakeSearcher) searchTracks(query string) ([]Song, error) {
+	s.searches++
+	return s.results, nil
+}
+
+type fakeMapping map[string]string
+
+func (m fakeMapping) DestinationTrack(song Song) (string, bool) {
+	id, ok := m[song.Id]
+	return id, ok
+}
+
+func (m fakeMapping) RecordTrack(song Song, id string) {
+	m[song.Id] = id
+}
+
+func TestResolveMapping(t *testing.T) {
+	source := Song{Name: "Dreams", Id: "source", Artists: []Artist{{Name: "Fleetwood Mac"}}, Album: Album{Name: "Rumours"}}
+	found := Song{Name: "Dreams", Id: "found", Artists: []Artist{{Name: "Fleetwood Mac"}}, Album: Album{Name: "Rumours"}}
+	tests := []struct {
+		name     string
+		mapping  fakeMapping
+		expected TrackMatch
+		searches int
+	}{
+		{"mapping hit carries only the id", fakeMapping{"source": "mapped"},
+			TrackMatch{Source: source, Track: &Song{Id: "mapped"}, Score: 1, Status: MATCH_MATCHED, Mapped: true}, 0},
+		{"search result is recorded", fakeMapping{},
+			TrackMatch{Source: source, Track: &found, Score: 1, Status: MATCH_MATCHED}, 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			searcher := &fakeSearcher{results: []Song{found}}
+			resolver := newTrackResolver(searcher, ServiceConfig{TrackMapping: test.mapping})
+
+			actual := resolver.resolve(source)
+			if !reflect.DeepEqual(actual, test.expected) {
+				t.Errorf("resolve() = %+v, want %+v", actual, test.expected)
+			}
+			if searcher.searches != test.searches {
+				t.Errorf("searched %d times, want %d", searcher.searches, test.searches)
+			}
+			if id := test.mapping["source"]; id != actual.Track.Id {
+				t.Errorf("recorded %s, want %s", id, actual.Track.Id)
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"musicserviceclients"
+	"strings"
+)
+
+// printPlan writes what a dry run would do to a playlist: the tracks songs matched, the
+// matches that were too close to call, the songs that were not found and the ones skipped.
+func printPlan(w io.Writer, playlistName string, matches []musicserviceclients.TrackMatch, removed, unmigratable []musicserviceclients.Song) {
+	counts := make(map[musicserviceclients.MatchStatus]int)
+	for _, match := range matches {
+		counts[match.Status]++
+	}
+	fmt.Fprintf(w, "Playlist %s [matched=%d, ambiguous=%d, not found=%d, failed=%d, removed=%d, skipped=%d]\n", playlistName,
+		counts[musicserviceclients.MATCH_MATCHED], counts[musicserviceclients.MATCH_AMBIGUOUS],
+		counts[musicserviceclients.MATCH_NOT_FOUND], counts[musicserviceclients.MATCH_FAILED], len(removed), len(unmigratable))
+	for _, match := range matches {
+		switch {
+		case match.Mapped:
+			fmt.Fprintf(w, "  %-10s %s -> recorded mapping [id=%s]\n", match.Status, songTitle(match.Source), match.Track.Id)
+		case match.Status == musicserviceclients.MATCH_MATCHED, match.Status == musicserviceclients.MATCH_AMBIGUOUS:
+			fmt.Fprintf(w, "  %-10s %s -> %s [id=%s, score=%.2f]\n", match.Status, songTitle(match.Source), songTitle(*match.Track), match.Track.Id, match.Score)
+		case match.Status == musicserviceclients.MATCH_FAILED:
+			fmt.Fprintf(w, "  %-10s %s [err=%v]\n", match.Status, songTitle(match.Source), match.Err)
+		default:
+			fmt.Fprintf(w, "  %-10s %s\n", match.Status, songTitle(match.Source))
+		}
+	}
+	for _, song := range removed {
+		fmt.Fprintf(w, "  %-10s %s\n", "removed", songTitle(song))
+	}
+	for _, song := range unmigratable {
+		fmt.Fprintf(w, "  %-10s %s [reason=%s]\n", "skipped", songTitle(song), song.Unmigratable)
+	}
+}
+
+func songTitle(song musicserviceclients.Song) string {
+	var artists []string
+	for _, artist := range song.Artists {
+		artists = append(artists, artist.Name)
+	}
+	if len(artists) == 0 {
+		return song.Name
+	}
+	return strings.Join(artists, ", ") + " - " + song.Name
+}
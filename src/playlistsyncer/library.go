@@ -0,0 +1,149 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"musicserviceclients"
+	"os"
+	"strings"
+)
+
+const (
+	LIBRARY_TRACKS  = "tracks"
+	LIBRARY_ALBUMS  = "albums"
+	LIBRARY_ARTISTS = "artists"
+)
+
+var libraryItems = []string{LIBRARY_TRACKS, LIBRARY_ALBUMS, LIBRARY_ARTISTS}
+
+// Saved tracks are reported like a playlist of this name.
+const SAVED_TRACKS_NAME = "Saved tracks"
+
+// migrateLibrary copies the saved tracks, saved albums and followed artists named in items.
+// Items one of the services has no library for are skipped.
+func migrateLibrary(source musicserviceclients.MediaServiceClient, destination destination, items []string) {
+	for _, item := range items {
+		switch item {
+		case LIBRARY_TRACKS:
+			migrateSavedTracks(source, destination)
+		case LIBRARY_ALBUMS:
+			migrateSavedAlbums(source, destination)
+		case LIBRARY_ARTISTS:
+			migrateFollowedArtists(source, destination)
+		}
+		destination.saveState()
+	}
+}
+
+func migrateSavedTracks(source musicserviceclients.MediaServiceClient, destination destination) {
+	log.Println("Listing saved tracks")
+	songs, err := source.ListSavedTracks()
+	if err != nil {
+		logLibraryError(LIBRARY_TRACKS, err)
+		return
+	}
+	migratable, unmigratable := splitMigratable(SAVED_TRACKS_NAME, songs)
+	log.Printf("Saving %d tracks", len(migratable))
+	matches, err := destination.client.SaveTracks(migratable)
+	if err != nil {
+		log.Printf("Failed to save tracks for [service=%s, err=%v]", destination.service, err)
+		logFailures(SAVED_TRACKS_NAME, err)
+	}
+	destination.recordPlaylist(musicserviceclients.Playlist{Name: SAVED_TRACKS_NAME, Songs: songs}, "", matches, nil, err)
+	if destination.dryRun {
+		printPlan(os.Stdout, SAVED_TRACKS_NAME, matches, nil, unmigratable)
+	}
+}
+
+func migrateSavedAlbums(source musicserviceclients.MediaServiceClient, destination destination) {
+	log.Println("Listing saved albums")
+	albums, err := source.ListSavedAlbums()
+	if err != nil {
+		logLibraryError(LIBRARY_ALBUMS, err)
+		return
+	}
+	log.Printf("Saving %d albums", len(albums))
+	saved, err := destination.client.SaveAlbums(albums)
+	if err != nil {
+		logLibraryError(LIBRARY_ALBUMS, err)
+		if errors.Is(err, errors.ErrUnsupported) {
+			return
+		}
+	}
+	if destination.dryRun {
+		fmt.Fprintf(os.Stdout, "Albums [matched=%d, not matched=%d]\n", len(saved), len(albums)-len(saved))
+		for _, album := range saved {
+			fmt.Fprintf(os.Stdout, "  %-10s %s [id=%s]\n", musicserviceclients.MATCH_MATCHED, albumTitle(album), album.Id)
+		}
+		return
+	}
+	log.Printf("Saved %d of %d albums", len(saved), len(albums))
+}
+
+func migrateFollowedArtists(source musicserviceclients.MediaServiceClient, destination destination) {
+	log.Println("Listing followed artists")
+	artists, err := source.ListFollowedArtists()
+	if err != nil {
+		logLibraryError(LIBRARY_ARTISTS, err)
+		return
+	}
+	log.Printf("Following %d artists", len(artists))
+	followed, err := destination.client.FollowArtists(artists)
+	if err != nil {
+		logLibraryError(LIBRARY_ARTISTS, err)
+		if errors.Is(err, errors.ErrUnsupported) {
+			return
+		}
+	}
+	if destination.dryRun {
+		fmt.Fprintf(os.Stdout, "Artists [matched=%d, not matched=%d]\n", len(followed), len(artists)-len(followed))
+		for _, artist := range followed {
+			fmt.Fprintf(os.Stdout, "  %-10s %s [id=%s]\n", musicserviceclients.MATCH_MATCHED, artist.Name, artist.Id)
+		}
+		return
+	}
+	log.Printf("Followed %d of %d artists", len(followed), len(artists))
+}
+
+func logLibraryError(item string, err error) {
+	if errors.Is(err, errors.ErrUnsupported) {
+		log.Printf("Skipping %s, unsupported by the service [err=%v]", item, err)
+	} else {
+		log.Printf("Failed to migrate %s [err=%v]", item, err)
+	}
+}
+
+func albumTitle(album musicserviceclients.Album) string {
+	var artists []string
+	for _, artist := range album.Artists {
+		artists = append(artists, artist.Name)
+	}
+	if len(artists) == 0 {
+		return album.Name
+	}
+	return strings.Join(artists, ", ") + " - " + album.Name
+}
+
+// parseLibraryItems splits a comma separated list of library items.
+func parseLibraryItems(value string) ([]string, error) {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		item = strings.ToLower(strings.TrimSpace(item))
+		if len(item) == 0 {
+			continue
+		}
+		valid := false
+		for _, libraryItem := range libraryItems {
+			valid = valid || item == libraryItem
+		}
+		if !valid {
+			return nil, fmt.Errorf("Invalid library item=%s", item)
+		}
+		items = append(items, item)
+	}
+	if len(items) == 0 {
+		return nil, fmt.Errorf("Invalid library items=%s", value)
+	}
+	return items, nil
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+	"musicserviceclients"
+	"musicserviceclients/fakes"
+	"musicserviceclients/matcher"
+	"musicserviceclients/models"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"report"
+	"statestore"
+	"testing"
+)
+
+const (
+	FIXTURE_SPOTIFY_ROAD_TRIP = "5Ne1Ra8XGBeXvnBT1JhR3y"
+	FIXTURE_GPM_CREATED       = "f4d2c1b0-9a8e-4c7d-b6a5-3e2f1d0c9b8a"
+)
+
+// TestMigrateSpotifyToGpm runs a whole migration against the recorded fixtures of both services.
+func TestMigrateSpotifyToGpm(t *testing.T) {
+	spotifyServer, err := fakes.NewSpotifyServer()
+	if err != nil {
+		t.Fatalf("failed to start spotify server [err=%v]", err)
+	}
+	defer spotifyServer.Close()
+	gpmServer, err := fakes.NewGpmServer()
+	if err != nil {
+		t.Fatalf("failed to start gpm server [err=%v]", err)
+	}
+	defer gpmServer.Close()
+	config := musicserviceclients.ServiceConfig{
+		Matcher:     matcher.NewMatcher(matcher.DEFAULT_THRESHOLD),
+		RetryPolicy: musicserviceclients.RetryPolicy{MaxRetries: -1},
+		Spotify:     musicserviceclients.SpotifyConfig{BaseUrl: spotifyServer.SpotifyBaseUrl(), TokenUrl: spotifyServer.SpotifyTokenUrl()},
+		Gpm: musicserviceclients.GpmConfig{BaseUrl: gpmServer.GpmBaseUrl(), Authenticate: func(username, password string) (string, error) {
+			return "fixture-token", nil
+		}},
+		CredentialProvider: musicserviceclients.FlagProvider{
+			musicserviceclients.CREDENTIAL_SPOTIFY_TOKEN: "fixture-token",
+			musicserviceclients.CREDENTIAL_GPM_USERNAME:  "fixture@example.com",
+			musicserviceclients.CREDENTIAL_GPM_PASSWORD:  "fixture-password"}}
+	store, err := statestore.Open(filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatalf("failed to open state [err=%v]", err)
+	}
+	mapping := store.Mapping(musicserviceclients.SERVICE_SPOTIFY, musicserviceclients.SERVICE_GOOGLE_PLAY_MUSIC)
+	destinationConfig := config
+	destinationConfig.TrackMapping = mapping
+	destination := destination{
+		client:  newLoggedInClient(t, musicserviceclients.SERVICE_GOOGLE_PLAY_MUSIC, destinationConfig),
+		service: musicserviceclients.SERVICE_GOOGLE_PLAY_MUSIC,
+		store:   store,
+		mapping: mapping,
+		report:  report.New(musicserviceclients.SERVICE_SPOTIFY, musicserviceclients.SERVICE_GOOGLE_PLAY_MUSIC, false)}
+	source := newLoggedInClient(t, musicserviceclients.SERVICE_SPOTIFY, config)
+	selection, err := newPlaylistSelection([]string{"Road Trip"}, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to select playlist [err=%v]", err)
+	}
+
+	createPlaylists(destination, listPlaylists(source, musicserviceclients.SERVICE_SPOTIFY, selection))
+
+	var created models.GpmCreatePlaylistRequestMutations
+	decodeRequest(t, gpmServer, "/sj/v2.5/playlistbatch", &created)
+	if len(created.Mutations) != 1 {
+		t.Fatalf("created %d playlists, want 1", len(created.Mutations))
+	}
+	playlist := created.Mutations[0].GpmCreatePlaylist
+	if playlist.Name != "Road Trip" || playlist.Description != "Songs for the long drive" || playlist.ShareState != models.GPM_PLAYLIST_SHARESTATE_PRIVATE {
+		t.Errorf("created playlist [name=%s][description=%s][shareState=%s], want [name=Road Trip][description=Songs for the long drive][shareState=PRIVATE]",
+			playlist.Name, playlist.Description, playlist.ShareState)
+	}
+
+	var added models.GpmCreateSongEntryMutations
+	decodeRequest(t, gpmServer, "/sj/v2.5/plentriesbatch", &added)
+	var trackIds []string
+	for _, entry := range added.Mutations {
+		trackIds = append(trackIds, entry.CreateGpmSongEntry.SongId)
+		if entry.CreateGpmSongEntry.PlayListId != FIXTURE_GPM_CREATED {
+			t.Errorf("added entry to playlist %s, want %s", entry.CreateGpmSongEntry.PlayListId, FIXTURE_GPM_CREATED)
+		}
+	}
+	expected := []string{"Tj6fhurtstzgdpvfm4xv6i5cei4", "Tqq2zk4dgiafh6wpw2nj3m6lvie", "Tmqmu4psvbiy4rd5xbdz5cfvkqe"}
+	if !reflect.DeepEqual(trackIds, expected) {
+		t.Errorf("added tracks %v, want %v", trackIds, expected)
+	}
+
+	if id, ok := mapping.DestinationPlaylist(FIXTURE_SPOTIFY_ROAD_TRIP); !ok || id != FIXTURE_GPM_CREATED {
+		t.Errorf("recorded destination playlist %s, want %s", id, FIXTURE_GPM_CREATED)
+	}
+	if len(destination.report.Playlists) != 1 {
+		t.Fatalf("reported %d playlists, want 1", len(destination.report.Playlists))
+	}
+	for _, song := range destination.report.Playlists[0].Songs {
+		if song.Status != string(musicserviceclients.MATCH_MATCHED) {
+			t.Errorf("reported %s as %s, want matched", song.Source.Name, song.Status)
+		}
+	}
+	for _, server := range []*fakes.Server{spotifyServer, gpmServer} {
+		for _, request := range server.Unmatched() {
+			t.Errorf("unexpected request [method=%s][path=%s][query=%s]", request.Method, request.Path, request.Query.Encode())
+		}
+	}
+}
+
+func newLoggedInClient(t *testing.T, service string, config musicserviceclients.ServiceConfig) musicserviceclients.MediaServiceClient {
+	t.Helper()
+	client, err := musicserviceclients.NewClient(service, config)
+	if err != nil {
+		t.Fatalf("failed to create client [service=%s][err=%v]", service, err)
+	}
+	err = client.Login()
+	if err != nil {
+		t.Fatalf("failed to login [service=%s][err=%v]", service, err)
+	}
+	return client
+}
+
+// decodeRequest decodes the body of the only POST the server received for path.
+func decodeRequest(t *testing.T, server *fakes.Server, path string, v interface{}) {
+	t.Helper()
+	var bodies [][]byte
+	for _, request := range server.Requests() {
+		if request.Method == http.MethodPost && request.Path == path {
+			bodies = append(bodies, request.Body)
+		}
+	}
+	if len(bodies) != 1 {
+		t.Fatalf("sent %d requests to %s, want 1", len(bodies), path)
+	}
+	err := json.Unmarshal(bodies[0], v)
+	if err != nil {
+		t.Fatalf("failed to parse request [path=%s][err=%v]", path, err)
+	}
+}
@@ -1,123 +1,555 @@
 package main
 
 import (
+	"credentialstore"
 	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"musicserviceclients"
+	"musicserviceclients/matcher"
+	"os"
+	"report"
+	"snapshot"
+	"statestore"
+	"strings"
 )
 
 const PLAYLIST_ALL = "--all"
 
-//Services
+const ENV_PASSPHRASE = "PLAYLISTSYNCER_PASSPHRASE"
+
 const (
-	SPOTIFY           = "spotify"
-	GOOGLE_PLAY_MUSIC = "gpm"
+	COMMAND_MIGRATE = "migrate"
+	COMMAND_SYNC    = "sync"
+	COMMAND_EXPORT  = "export"
+	COMMAND_IMPORT  = "import"
+	COMMAND_LOGIN   = "login"
+	COMMAND_LOGOUT  = "logout"
+	COMMAND_LIBRARY = "library"
 )
 
 type CliArguments struct {
+	command            string
 	sourceService      string
 	destinationService string
-	playList           string
+	playlists          *playlistSelection
+	directory          string
+	snapshotFile       string
+	stateFile          string
+	matchThreshold     float64
+	workers            int
+	requestsPerSecond  float64
+	maxRetries         int
+	spotify            musicserviceclients.SpotifyConfig
+	gpm                musicserviceclients.GpmConfig
+	credentialsFile    string
+	keyFile            string
+	sourceAccount      string
+	destinationAccount string
+	secrets            musicserviceclients.FlagProvider
+	secretsFile        string
+	noPrompt           bool
+	dryRun             bool
+	reportFile         string
+	reportFormat       string
+	interactive        bool
+	reviewCandidates   int
+	libraryItems       []string
+}
+
+type destination struct {
+	client  musicserviceclients.MediaServiceClient
+	service string
+	store   *statestore.Store
+	mapping *statestore.Mapping
+	matcher *matcher.Matcher
+	dryRun  bool
+	report  *report.Report
 }
 
 func main() {
-	args, err := parseArgs()
+	command, arguments := COMMAND_MIGRATE, os.Args[1:]
+	if len(arguments) > 0 && !strings.HasPrefix(arguments[0], "-") {
+		command, arguments = arguments[0], arguments[1:]
+	}
+	args, err := parseArgs(command, arguments)
 	if err != nil {
 		log.Fatalf("%v", err)
 	}
-	sourceClient, err := client(args.sourceService)
+	config := musicserviceclients.ServiceConfig{
+		Directory:         args.directory,
+		Matcher:           matcher.NewMatcher(args.matchThreshold),
+		Workers:           args.workers,
+		RequestsPerSecond: args.requestsPerSecond,
+		RetryPolicy:       retryPolicy(args.maxRetries),
+		Spotify:           args.spotify,
+		Gpm:               args.gpm,
+		DryRun:            args.dryRun}
+	if args.interactive {
+		config.Reviewer = &consoleReviewer{input: musicserviceclients.StdinCredentials, output: os.Stdout, limit: args.reviewCandidates}
+	}
+	config.CredentialProvider = credentialProvider(args)
+	credentials := openCredentials(args)
+	if credentials != nil {
+		config.Credentials = credentials
+	}
+	sourceConfig := config
+	sourceConfig.Account = args.sourceAccount
+	switch args.command {
+	case COMMAND_MIGRATE:
+		sourceClient := loggedInClient(args.sourceService, sourceConfig)
+		destination := newDestination(args, args.sourceService, config)
+		createPlaylists(destination, listPlaylists(sourceClient, args.sourceService, args.playlists))
+		destination.writeReport(args)
+	case COMMAND_SYNC:
+		sourceClient := loggedInClient(args.sourceService, sourceConfig)
+		destination := newDestination(args, args.sourceService, config)
+		syncPlaylists(destination, listPlaylists(sourceClient, args.sourceService, args.playlists))
+		destination.writeReport(args)
+	case COMMAND_LIBRARY:
+		sourceClient := loggedInClient(args.sourceService, sourceConfig)
+		destination := newDestination(args, args.sourceService, config)
+		migrateLibrary(sourceClient, destination, args.libraryItems)
+		destination.writeReport(args)
+	case COMMAND_EXPORT:
+		sourceClient := loggedInClient(args.sourceService, sourceConfig)
+		library := snapshot.NewLibrary(args.sourceService, listPlaylists(sourceClient, args.sourceService, args.playlists))
+		err = snapshot.Write(args.snapshotFile, library)
+		if err != nil {
+			log.Fatalf("Failed to export playlists [file=%s, err=%v]", args.snapshotFile, err)
+		}
+		log.Printf("Exported %d playlists to %s", len(library.Playlists), args.snapshotFile)
+	case COMMAND_IMPORT:
+		library, err := snapshot.Read(args.snapshotFile)
+		if err != nil {
+			log.Fatalf("Failed to import playlists [file=%s, err=%v]", args.snapshotFile, err)
+		}
+		source := library.Source
+		if len(source) == 0 {
+			source = args.snapshotFile
+		}
+		destination := newDestination(args, source, config)
+		var playlists []musicserviceclients.Playlist
+		for _, playlist := range library.MediaPlaylists() {
+			if args.playlists.matches(playlist.Name, playlist.Id) {
+				playlists = append(playlists, playlist)
+			}
+		}
+		for _, missing := range args.playlists.missing(playlists) {
+			log.Printf("Failed to find playlist in snapshot [%s, file=%s]", missing, args.snapshotFile)
+		}
+		if len(playlists) == 0 {
+			log.Fatalf("Failed to find playlists in snapshot [file=%s]", args.snapshotFile)
+		}
+		createPlaylists(destination, playlists)
+		destination.writeReport(args)
+	case COMMAND_LOGIN:
+		if credentials == nil {
+			log.Fatalf("Set %s or -key-file to cache credentials", ENV_PASSPHRASE)
+		}
+		loggedInClient(args.sourceService, sourceConfig)
+		log.Printf("Cached credentials for %s in %s", args.sourceService, args.credentialsFile)
+	case COMMAND_LOGOUT:
+		if credentials == nil {
+			log.Fatalf("Set %s or -key-file to open the credential cache", ENV_PASSPHRASE)
+		}
+		removed, err := credentials.DeleteCredential(args.sourceService, args.sourceAccount)
+		if err != nil {
+			log.Fatalf("Failed to remove credentials [service=%s, err=%v]", args.sourceService, err)
+		}
+		log.Printf("Removed %d cached credentials for %s", removed, args.sourceService)
+	}
+}
+
+// credentialProvider looks credentials up in flags, then the environment, then the secrets file
+// and finally asks on stdin unless prompting is disabled.
+func credentialProvider(args *CliArguments) musicserviceclients.CredentialProvider {
+	chain := musicserviceclients.ChainProvider{args.secrets, musicserviceclients.EnvProvider{}}
+	if len(args.secretsFile) > 0 {
+		provider, err := musicserviceclients.NewFileProvider(args.secretsFile)
+		if err != nil {
+			log.Fatalf("Failed to read secrets [file=%s, err=%v]", args.secretsFile, err)
+		}
+		chain = append(chain, provider)
+	}
+	if !args.noPrompt {
+		chain = append(chain, musicserviceclients.StdinCredentials)
+	}
+	return chain
+}
+
+// openCredentials returns nil when no passphrase is configured, in which case every run asks
+// for credentials.
+func openCredentials(args *CliArguments) *credentialstore.Store {
+	passphrase, err := credentialstore.ReadPassphrase(args.keyFile, ENV_PASSPHRASE)
+	if err != nil {
+		log.Fatalf("Failed to read passphrase [err=%v]", err)
+	}
+	if len(passphrase) == 0 {
+		return nil
+	}
+	store, err := credentialstore.Open(args.credentialsFile, passphrase)
 	if err != nil {
-		log.Fatalf("Failed to initialize client for [service=%s, err=%v]", args.sourceService, err)
+		log.Fatalf("Failed to open credentials [file=%s, err=%v]", args.credentialsFile, err)
 	}
-	err = sourceClient.Login()
+	return store
+}
+
+func newDestination(args *CliArguments, sourceService string, config musicserviceclients.ServiceConfig) destination {
+	store, err := statestore.Open(args.stateFile)
 	if err != nil {
-		log.Fatalf("Failed to login for [service=%s, err=%v]", args.sourceService, err)
+		log.Fatalf("Failed to open state [file=%s, err=%v]", args.stateFile, err)
+	}
+	mapping := store.Mapping(sourceService, args.destinationService)
+	config.TrackMapping = mapping
+	config.Account = args.destinationAccount
+	client := loggedInClient(args.destinationService, config)
+	destination := destination{client: client, service: args.destinationService, store: store, mapping: mapping, matcher: config.Matcher, dryRun: args.dryRun}
+	if len(args.reportFile) > 0 {
+		destination.report = report.New(sourceService, args.destinationService, args.dryRun)
+	}
+	return destination
+}
+
+func (d destination) recordPlaylist(playlist musicserviceclients.Playlist, destinationId string, matches []musicserviceclients.TrackMatch, removed []musicserviceclients.Song, err error) {
+	if d.report != nil {
+		d.report.AddPlaylist(playlist, destinationId, matches, removed, err)
 	}
-	destinationClient, err := client(args.destinationService)
+}
+
+func (d destination) writeReport(args *CliArguments) {
+	if d.report == nil {
+		return
+	}
+	err := report.Write(args.reportFile, args.reportFormat, d.report)
 	if err != nil {
-		log.Fatalf("Failed to initialize client for [service=%s, err=%v]", args.destinationService, err)
+		log.Printf("Failed to write report [file=%s, err=%v]", args.reportFile, err)
+		return
 	}
-	err = destinationClient.Login()
+	log.Printf("Wrote report to %s", args.reportFile)
+}
+
+// saveState does nothing in a dry run, which must leave no trace.
+func (d destination) saveState() {
+	if d.dryRun {
+		return
+	}
+	err := d.store.Save()
 	if err != nil {
-		log.Fatalf("Failed to login for [service=%s, err=%v]", args.destinationService, err)
+		log.Printf("Failed to save state [service=%s, err=%v]", d.service, err)
 	}
-	if args.playList == PLAYLIST_ALL {
+}
+
+func retryPolicy(maxRetries int) musicserviceclients.RetryPolicy {
+	if maxRetries == 0 {
+		return musicserviceclients.RetryPolicy{MaxRetries: -1}
+	}
+	return musicserviceclients.RetryPolicy{MaxRetries: maxRetries}
+}
+
+func loggedInClient(service string, config musicserviceclients.ServiceConfig) musicserviceclients.MediaServiceClient {
+	client, err := musicserviceclients.NewClient(service, config)
+	if err != nil {
+		log.Fatalf("Failed to initialize client for [service=%s, err=%v]", service, err)
+	}
+	err = client.Login()
+	if err != nil {
+		log.Fatalf("Failed to login for [service=%s, err=%v]", service, err)
+	}
+	return client
+}
+
+func listPlaylists(client musicserviceclients.MediaServiceClient, service string, selection *playlistSelection) []musicserviceclients.Playlist {
+	if selection.all && len(selection.excludes) == 0 {
 		log.Println("Listing all playlists")
-		playlists, err := sourceClient.ListAllPlaylists()
-		if err != nil {
-			log.Fatalf("Failed to list playlists for [service=%s, err=%v]", args.sourceService, err)
-		}
-		for _, playlist := range playlists {
-			log.Printf("Creating Playlist %s", playlist.Name)
-			err = destinationClient.CreatePlaylist(playlist.Name, playlist.Description, playlist.Songs)
-			if err != nil {
-				log.Printf("Failed to create playlist for [name=%s, service=%s, err=%v]", playlist.Name, args.destinationService, err)
-			}
-		}
-	} else {
-		log.Printf("Listing %s playlist", args.playList)
-		playlist, err := sourceClient.ListPlaylist(args.playList)
+		playlists, err := client.ListAllPlaylists()
 		if err != nil {
-			log.Fatalf("Failed to list playlist for [name=%s, service=%s, err=%v]", args.playList, args.sourceService, err)
+			log.Fatalf("Failed to list playlists for [service=%s, err=%v]", service, err)
 		}
+		return playlists
+	}
+	log.Println("Listing selected playlists")
+	playlists, err := client.ListPlaylists(selection.matches)
+	if err != nil {
+		log.Fatalf("Failed to list playlists for [service=%s, err=%v]", service, err)
+	}
+	for _, missing := range selection.missing(playlists) {
+		log.Printf("Failed to find playlist for [%s, service=%s]", missing, service)
+	}
+	if len(playlists) == 0 {
+		log.Fatalf("Failed to find any selected playlist for [service=%s]", service)
+	}
+	return playlists
+}
+
+func createPlaylists(destination destination, playlists []musicserviceclients.Playlist) {
+	for _, playlist := range playlists {
 		log.Printf("Creating Playlist %s", playlist.Name)
-		err = destinationClient.CreatePlaylist(playlist.Name, playlist.Description, playlist.Songs)
+		migratable := playlist
+		var unmigratable []musicserviceclients.Song
+		migratable.Songs, unmigratable = splitMigratable(playlist.Name, playlist.Songs)
+		result, err := destination.client.CreatePlaylist(migratable)
 		if err != nil {
-			log.Printf("Failed to create playlist for [name=%s, service=%s, err=%v]", playlist.Name, args.destinationService, err)
+			log.Printf("Failed to create playlist for [name=%s, service=%s, err=%v]", playlist.Name, destination.service, err)
+			logFailures(playlist.Name, err)
+		}
+		if result == nil {
+			destination.recordPlaylist(playlist, "", nil, nil, err)
+			continue
 		}
+		destination.recordPlaylist(playlist, result.Id, result.Matches, nil, err)
+		if destination.dryRun {
+			printPlan(os.Stdout, playlist.Name, result.Matches, nil, unmigratable)
+			continue
+		}
+		destination.mapping.RecordPlaylist(playlist.Id, result.Id)
+		destination.saveState()
 	}
 }
 
-func client(service string) (musicserviceclients.MediaServiceClient, error) {
-	switch service {
-	case SPOTIFY:
-		return musicserviceclients.NewSpotifyClient()
-	case GOOGLE_PLAY_MUSIC:
-		return musicserviceclients.NewGooglePlayMusicClient()
-	default:
-		return nil, fmt.Errorf("Unimplemented service %s", service)
+// splitMigratable drops the local files, episodes and unavailable tracks of a playlist, which
+// no destination can search for. They are still reported with the source playlist.
+func splitMigratable(playlistName string, songs []musicserviceclients.Song) ([]musicserviceclients.Song, []musicserviceclients.Song) {
+	migratable, unmigratable := musicserviceclients.SplitMigratable(songs)
+	if len(unmigratable) == 0 {
+		return migratable, nil
 	}
+	counts := make(map[musicserviceclients.UnmigratableReason]int)
+	for _, song := range unmigratable {
+		counts[song.Unmigratable]++
+	}
+	log.Printf("Skipping unmigratable songs for [name=%s, local files=%d, episodes=%d, unavailable=%d, removed=%d]", playlistName,
+		counts[musicserviceclients.UNMIGRATABLE_LOCAL_FILE],
+		counts[musicserviceclients.UNMIGRATABLE_EPISODE],
+		counts[musicserviceclients.UNMIGRATABLE_UNAVAILABLE],
+		counts[musicserviceclients.UNMIGRATABLE_REMOVED])
+	return migratable, unmigratable
 }
 
-func parseArgs() (*CliArguments, error) {
-	sourceService := flag.String("source", "", "The source music service")
-	destinationService := flag.String("destination", "", "The destination music service")
-	playList := flag.String("playlist", "", "The name of the playlist you want to transfer. Use '--all' for moving all playlists")
-	flag.Parse()
+// logFailures counts the songs that failed by reason.
+func logFailures(playlistName string, err error) {
+	var multiErr *musicserviceclients.MultiError
+	if errors.As(err, &multiErr) {
+		log.Printf("Failed songs for [name=%s, not found=%d, http errors=%d, rejected=%d]", playlistName,
+			multiErr.Count(musicserviceclients.REASON_NOT_FOUND),
+			multiErr.Count(musicserviceclients.REASON_HTTP_ERROR),
+			multiErr.Count(musicserviceclients.REASON_REJECTED))
+	}
+}
 
+func parseArgs(command string, arguments []string) (*CliArguments, error) {
+	flags := flag.NewFlagSet(command, flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: playlistsyncer [%s|%s|%s|%s|%s|%s|%s] [flags]\n", COMMAND_MIGRATE, COMMAND_SYNC, COMMAND_LIBRARY, COMMAND_EXPORT, COMMAND_IMPORT, COMMAND_LOGIN, COMMAND_LOGOUT)
+		flags.PrintDefaults()
+	}
+	sourceCapability, destinationCapability := musicserviceclients.CAPABILITY_READ, musicserviceclients.CAPABILITY_WRITE
+	if command == COMMAND_LIBRARY {
+		sourceCapability |= musicserviceclients.CAPABILITY_LIBRARY
+		destinationCapability |= musicserviceclients.CAPABILITY_LIBRARY
+	}
+	var sourceService, destinationService, snapshotFile, sourceAccount, destinationAccount, items *string
+	if command == COMMAND_MIGRATE || command == COMMAND_SYNC || command == COMMAND_LIBRARY || command == COMMAND_EXPORT {
+		sourceService = flags.String("source", "", fmt.Sprintf("The source music service. One of [%s]", serviceNames(sourceCapability)))
+		sourceAccount = flags.String("source-account", "", "The cached account to log in to the source service with")
+	}
+	if command == COMMAND_MIGRATE || command == COMMAND_SYNC || command == COMMAND_LIBRARY || command == COMMAND_IMPORT {
+		destinationService = flags.String("destination", "", fmt.Sprintf("The destination music service. One of [%s]", serviceNames(destinationCapability)))
+		destinationAccount = flags.String("destination-account", "", "The cached account to log in to the destination service with")
+	}
+	if command == COMMAND_LIBRARY {
+		items = flags.String("items", strings.Join(libraryItems, ","), "The comma separated library items to migrate")
+	}
+	if command == COMMAND_LOGIN || command == COMMAND_LOGOUT {
+		sourceService = flags.String("service", "", fmt.Sprintf("The music service. One of [%s]", serviceNames(0)))
+		sourceAccount = flags.String("account", "", "The account to log in with or to remove. Logout removes every account of the service when empty")
+	}
+	if command == COMMAND_EXPORT || command == COMMAND_IMPORT {
+		snapshotFile = flags.String("file", "", "The .json, .yaml or .yml snapshot file to export to or import from")
+	}
+	var playlistNames, playlistIds, includes, excludes stringList
+	flags.Var(&playlistNames, "playlist", "The name of a playlist you want to transfer, ignoring case. Repeat for several playlists. Use '--all' for moving all playlists")
+	flags.Var(&playlistIds, "playlist-id", "The id of a playlist you want to transfer. Repeat for several playlists")
+	flags.Var(&includes, "include", fmt.Sprintf("Transfer the playlists whose name matches a glob such as 'Workout*', or a regular expression prefixed with '%s'. Repeatable", REGEX_PREFIX))
+	flags.Var(&excludes, "exclude", fmt.Sprintf("Skip the playlists whose name matches a glob, or a regular expression prefixed with '%s'. Repeatable", REGEX_PREFIX))
+	directory := flags.String("directory", "playlists", "The directory holding playlist files for the file service")
+	stateFile := flags.String("state", ".playlistsyncer-state.json", "The file remembering which playlists and tracks were already migrated")
+	workers := flags.Int("workers", musicserviceclients.DEFAULT_WORKERS, "The number of songs matched concurrently on the destination")
+	requestsPerSecond := flags.Float64("rate", musicserviceclients.DEFAULT_REQUESTS_PER_SECOND, "The maximum number of requests per second sent to each service. Use 0 for no limit")
+	maxRetries := flags.Int("max-retries", musicserviceclients.DEFAULT_MAX_RETRIES, "The number of times a failed request is retried. Use 0 to disable retries")
+	spotifyClientId := flags.String("spotify-client-id", "", "The client id of your Spotify application. When set you log in to Spotify with your browser")
+	spotifyRedirectUrl := flags.String("spotify-redirect-url", musicserviceclients.SPOTIFY_REDIRECT_URL, "The loopback redirect URL registered for your Spotify application")
+	spotifyTokenUrl := flags.String("spotify-token-url", musicserviceclients.SPOTIFY_TOKEN_URL, "The Spotify OAuth token endpoint")
+	spotifyAuthorizeUrl := flags.String("spotify-authorize-url", musicserviceclients.SPOTIFY_AUTHORIZE_URL, "The Spotify OAuth authorization endpoint")
+	spotifyApiUrl := flags.String("spotify-api-url", musicserviceclients.BASE_SPOTIFY_URI, "The Spotify Web API endpoint, e.g. a local fake server")
+	gpmApiUrl := flags.String("gpm-api-url", musicserviceclients.BASE_GPM_URI, "The Google Play Music API endpoint, e.g. a local fake server")
+	credentialsFile := flags.String("credentials", ".playlistsyncer-credentials", fmt.Sprintf("The encrypted file caching service credentials. Used when %s or -key-file is set", ENV_PASSPHRASE))
+	keyFile := flags.String("key-file", "", fmt.Sprintf("The file holding the passphrase of the credential cache. Overrides %s", ENV_PASSPHRASE))
+	spotifyToken := flags.String("spotify-token", "", fmt.Sprintf("The Spotify OAuth token. Also read from %s", musicserviceclients.CredentialEnv(musicserviceclients.CREDENTIAL_SPOTIFY_TOKEN)))
+	gpmUsername := flags.String("gpm-username", "", fmt.Sprintf("The gmail id for Google Play Music. Also read from %s", musicserviceclients.CredentialEnv(musicserviceclients.CREDENTIAL_GPM_USERNAME)))
+	gpmPassword := flags.String("gpm-password", "", fmt.Sprintf("The gmail password for Google Play Music. Prefer %s, flags are visible to other users", musicserviceclients.CredentialEnv(musicserviceclients.CREDENTIAL_GPM_PASSWORD)))
+	secretsFile := flags.String("secrets-file", "", fmt.Sprintf("A file of key=value lines with the keys %s, %s and %s", musicserviceclients.CREDENTIAL_SPOTIFY_TOKEN, musicserviceclients.CREDENTIAL_GPM_USERNAME, musicserviceclients.CREDENTIAL_GPM_PASSWORD))
+	var dryRun, interactive *bool
+	var reviewCandidates *int
+	if command == COMMAND_MIGRATE || command == COMMAND_SYNC || command == COMMAND_LIBRARY || command == COMMAND_IMPORT {
+		dryRun = flags.Bool("dry-run", false, "Match songs on the destination and print the planned changes without writing anything")
+		interactive = flags.Bool("interactive", false, "Ask which track to use for ambiguous and unmatched songs. Choices are remembered in the state file")
+		reviewCandidates = flags.Int("candidates", DEFAULT_REVIEW_CANDIDATES, "The number of candidates shown for a song in interactive mode")
+	}
+	var reportFile, reportFormat *string
+	if command == COMMAND_MIGRATE || command == COMMAND_SYNC || command == COMMAND_LIBRARY || command == COMMAND_IMPORT {
+		reportFile = flags.String("report", "", "The file to write a report of every matched, unmatched and failed song to")
+		reportFormat = flags.String("report-format", "", fmt.Sprintf("The report format. One of [%s, %s, %s], derived from the -report extension by default", report.FORMAT_JSON, report.FORMAT_CSV, report.FORMAT_HTML))
+	}
+	noPrompt := flags.Bool("no-prompt", false, "Fail instead of asking on stdin for missing credentials")
+	matchThreshold := flags.Float64("match-threshold", matcher.DEFAULT_THRESHOLD, "The minimum score between 0 and 1 a search result needs to be accepted as a match")
+	switch command {
+	case COMMAND_MIGRATE, COMMAND_SYNC, COMMAND_LIBRARY, COMMAND_EXPORT, COMMAND_IMPORT, COMMAND_LOGIN, COMMAND_LOGOUT:
+	default:
+		flags.Usage()
+		return nil, fmt.Errorf("Unknown command %s", command)
+	}
+	err := flags.Parse(arguments)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse args [err=%v]", err)
+	}
+
+	args := &CliArguments{
+		command:           command,
+		directory:         *directory,
+		stateFile:         *stateFile,
+		matchThreshold:    *matchThreshold,
+		workers:           *workers,
+		requestsPerSecond: *requestsPerSecond,
+		maxRetries:        *maxRetries,
+		spotify: musicserviceclients.SpotifyConfig{
+			ClientId:     *spotifyClientId,
+			RedirectUrl:  *spotifyRedirectUrl,
+			AuthorizeUrl: *spotifyAuthorizeUrl,
+			TokenUrl:     *spotifyTokenUrl,
+			BaseUrl:      *spotifyApiUrl},
+		gpm:             musicserviceclients.GpmConfig{BaseUrl: *gpmApiUrl},
+		credentialsFile: *credentialsFile,
+		keyFile:         *keyFile,
+		secrets: musicserviceclients.FlagProvider{
+			musicserviceclients.CREDENTIAL_SPOTIFY_TOKEN: *spotifyToken,
+			musicserviceclients.CREDENTIAL_GPM_USERNAME:  *gpmUsername,
+			musicserviceclients.CREDENTIAL_GPM_PASSWORD:  *gpmPassword},
+		secretsFile: *secretsFile,
+		noPrompt:    *noPrompt}
+	if dryRun != nil {
+		args.dryRun = *dryRun
+		args.interactive = *interactive
+		args.reviewCandidates = *reviewCandidates
+	}
 	var errs []error
-	if len(*sourceService) == 0 || !validService(*sourceService) {
-		errs = append(errs, fmt.Errorf("Invalid source service=%s", *sourceService))
+	if sourceService != nil {
+		args.sourceService = *sourceService
+		args.sourceAccount = *sourceAccount
+		if command == COMMAND_LOGIN || command == COMMAND_LOGOUT {
+			if len(*sourceService) == 0 || !validService(*sourceService, 0) {
+				errs = append(errs, fmt.Errorf("Invalid service=%s", *sourceService))
+			}
+		} else if len(*sourceService) == 0 || !validService(*sourceService, sourceCapability) {
+			errs = append(errs, fmt.Errorf("Invalid source service=%s", *sourceService))
+		}
+	}
+
+	if destinationService != nil {
+		args.destinationService = *destinationService
+		args.destinationAccount = *destinationAccount
+		if len(*destinationService) == 0 || !validService(*destinationService, destinationCapability) {
+			errs = append(errs, fmt.Errorf("Invalid destination service=%s", *destinationService))
+		}
+	}
+
+	if items != nil {
+		var itemsErr error
+		args.libraryItems, itemsErr = parseLibraryItems(*items)
+		if itemsErr != nil {
+			errs = append(errs, itemsErr)
+		}
+	}
+
+	if snapshotFile != nil {
+		args.snapshotFile = *snapshotFile
+		if _, formatErr := snapshot.Format(*snapshotFile); formatErr != nil {
+			errs = append(errs, fmt.Errorf("Invalid snapshot file=%s", *snapshotFile))
+		}
+	}
+
+	if reportFile != nil && len(*reportFile) > 0 {
+		args.reportFile = *reportFile
+		args.reportFormat = strings.ToLower(*reportFormat)
+		if len(args.reportFormat) == 0 {
+			args.reportFormat, _ = report.Format(*reportFile)
+		}
+		switch args.reportFormat {
+		case report.FORMAT_JSON, report.FORMAT_CSV, report.FORMAT_HTML:
+		default:
+			errs = append(errs, fmt.Errorf("Invalid report format for file=%s", *reportFile))
+		}
 	}
 
-	if len(*destinationService) == 0 || !validService(*destinationService) {
-		errs = append(errs, fmt.Errorf("Invalid destination service=%s", *destinationService))
+	if args.interactive && args.reviewCandidates < 1 {
+		errs = append(errs, fmt.Errorf("Invalid candidates=%d", args.reviewCandidates))
 	}
 
-	if len(*playList) == 0 {
-		errs = append(errs, fmt.Errorf("You need to specify playlist to transfer"))
+	if args.interactive && args.noPrompt {
+		errs = append(errs, fmt.Errorf("Interactive mode needs prompts, remove -no-prompt"))
+	}
+
+	if *workers < 1 {
+		errs = append(errs, fmt.Errorf("Invalid workers=%d", *workers))
+	}
+
+	if *requestsPerSecond < 0 {
+		errs = append(errs, fmt.Errorf("Invalid rate=%v", *requestsPerSecond))
+	}
+
+	if *maxRetries < 0 {
+		errs = append(errs, fmt.Errorf("Invalid max retries=%d", *maxRetries))
+	}
+
+	if *matchThreshold < 0 || *matchThreshold > 1 {
+		errs = append(errs, fmt.Errorf("Invalid match threshold=%v", *matchThreshold))
+	}
+
+	args.playlists, err = newPlaylistSelection(playlistNames, playlistIds, includes, excludes)
+	if err != nil {
+		errs = append(errs, err)
+		err = nil
+	} else if args.playlists.empty() && command != COMMAND_LOGIN && command != COMMAND_LOGOUT && command != COMMAND_LIBRARY {
+		if command == COMMAND_IMPORT {
+			args.playlists.all = true
+		} else {
+			errs = append(errs, fmt.Errorf("You need to specify playlist to transfer"))
+		}
 	}
 
-	var err error
 	for _, v := range errs {
 		log.Printf("failed to parse args [error=%v]", v)
 		err = errors.New("failed to parse args")
 	}
 
 	if err != nil {
-		flag.PrintDefaults()
+		flags.Usage()
 		return nil, err
 	}
 
-	return &CliArguments{sourceService: *sourceService, destinationService: *destinationService, playList: *playList}, nil
+	return args, nil
+}
+
+func validService(service string, capability musicserviceclients.Capability) bool {
+	registered, ok := musicserviceclients.LookupService(service)
+	return ok && registered.Capabilities.Has(capability)
 }
 
-func validService(service string) bool {
-	if service == SPOTIFY || service == GOOGLE_PLAY_MUSIC {
-		return true
-	} else {
-		return false
+func serviceNames(capability musicserviceclients.Capability) string {
+	var names []string
+	for _, service := range musicserviceclients.ServicesWith(capability) {
+		names = append(names, fmt.Sprintf("%s (%s: %s)", service.Name, service.Description, service.Capabilities))
 	}
+	return strings.Join(names, ", ")
 }
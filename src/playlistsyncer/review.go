@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"musicserviceclients"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const DEFAULT_REVIEW_CANDIDATES = 5
+
+// consoleReviewer lists the top candidates of a song and reads the decision from the shared
+// stdin reader, so it does not compete with credential prompts.
+type consoleReviewer struct {
+	input  *musicserviceclients.StdinProvider
+	output io.Writer
+	limit  int
+}
+
+func (r *consoleReviewer) Review(song musicserviceclients.Song, candidates []musicserviceclients.ReviewCandidate) (musicserviceclients.ReviewDecision, error) {
+	if len(candidates) > r.limit {
+		candidates = candidates[:r.limit]
+	}
+	fmt.Fprintf(r.output, "\nReview %s%s\n", songTitle(song), trackDetails(song, -1))
+	if len(candidates) == 0 {
+		fmt.Fprintln(r.output, "  No candidates found")
+	}
+	for i, candidate := range candidates {
+		fmt.Fprintf(r.output, "  %d) %s%s\n", i+1, songTitle(candidate.Track), trackDetails(candidate.Track, candidate.Score))
+	}
+	for {
+		answer, err := r.input.Prompt(fmt.Sprintf("Pick 1-%d, q <query> to search again or s to skip [s]: ", len(candidates)))
+		if err != nil {
+			return musicserviceclients.ReviewDecision{}, err
+		}
+		switch {
+		case len(answer) == 0 || strings.EqualFold(answer, "s"):
+			return musicserviceclients.ReviewDecision{Action: musicserviceclients.REVIEW_SKIP}, nil
+		case strings.HasPrefix(strings.ToLower(answer), "q ") && len(strings.TrimSpace(answer[2:])) > 0:
+			return musicserviceclients.ReviewDecision{Action: musicserviceclients.REVIEW_QUERY, Query: strings.TrimSpace(answer[2:])}, nil
+		}
+		choice, err := strconv.Atoi(answer)
+		if err == nil && choice >= 1 && choice <= len(candidates) {
+			return musicserviceclients.ReviewDecision{Action: musicserviceclients.REVIEW_PICK, Index: choice - 1}, nil
+		}
+		fmt.Fprintf(r.output, "Invalid choice %q\n", answer)
+	}
+}
+
+// trackDetails formats the album, duration and, when it is not negative, the score of a track.
+func trackDetails(song musicserviceclients.Song, score float64) string {
+	var details []string
+	if len(song.Album.Name) > 0 {
+		details = append(details, "album="+song.Album.Name)
+	}
+	if song.Duration > 0 {
+		seconds := int(song.Duration / time.Second)
+		details = append(details, fmt.Sprintf("duration=%d:%02d", seconds/60, seconds%60))
+	}
+	if score >= 0 {
+		details = append(details, fmt.Sprintf("score=%.2f", score))
+	}
+	if len(details) == 0 {
+		return ""
+	}
+	return " [" + strings.Join(details, ", ") + "]"
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"musicserviceclients"
+	"regexp"
+	"strings"
+)
+
+// Patterns starting with this prefix are regular expressions, all others are globs.
+const REGEX_PREFIX = "re:"
+
+// stringList collects the values of a repeated flag.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ", ")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// playlistSelection picks playlists by exact name, id or include pattern and then drops the
+// ones matching an exclude pattern. Names and patterns ignore case.
+type playlistSelection struct {
+	all      bool
+	names    []string
+	ids      []string
+	includes []*regexp.Regexp
+	excludes []*regexp.Regexp
+}
+
+func newPlaylistSelection(names, ids, includes, excludes []string) (*playlistSelection, error) {
+	selection := &playlistSelection{ids: ids}
+	for _, name := range names {
+		if name == PLAYLIST_ALL {
+			selection.all = true
+		} else {
+			selection.names = append(selection.names, name)
+		}
+	}
+	for _, pattern := range includes {
+		compiled, err := compilePattern(pattern)
+		if err != nil {
+			return nil, err
+		}
+		selection.includes = append(selection.includes, compiled)
+	}
+	for _, pattern := range excludes {
+		compiled, err := compilePattern(pattern)
+		if err != nil {
+			return nil, err
+		}
+		selection.excludes = append(selection.excludes, compiled)
+	}
+	if len(selection.names) == 0 && len(selection.ids) == 0 && len(selection.includes) == 0 && len(selection.excludes) > 0 {
+		selection.all = true
+	}
+	return selection, nil
+}
+
+func (s *playlistSelection) empty() bool {
+	return !s.all && len(s.names) == 0 && len(s.ids) == 0 && len(s.includes) == 0
+}
+
+func (s *playlistSelection) matches(name, id string) bool {
+	for _, exclude := range s.excludes {
+		if exclude.MatchString(name) {
+			return false
+		}
+	}
+	if s.all {
+		return true
+	}
+	for _, selected := range s.names {
+		if musicserviceclients.SamePlaylistName(selected, name) {
+			return true
+		}
+	}
+	for _, selected := range s.ids {
+		if selected == id {
+			return true
+		}
+	}
+	for _, include := range s.includes {
+		if include.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// missing returns the names and ids that were asked for but not found in playlists.
+func (s *playlistSelection) missing(playlists []musicserviceclients.Playlist) []string {
+	var missing []string
+	for _, name := range s.names {
+		found := false
+		for _, playlist := range playlists {
+			found = found || musicserviceclients.SamePlaylistName(name, playlist.Name)
+		}
+		if !found {
+			missing = append(missing, fmt.Sprintf("name=%s", name))
+		}
+	}
+	for _, id := range s.ids {
+		found := false
+		for _, playlist := range playlists {
+			found = found || playlist.Id == id
+		}
+		if !found {
+			missing = append(missing, fmt.Sprintf("id=%s", id))
+		}
+	}
+	return missing
+}
+
+// compilePattern compiles a "re:" regular expression or a glob where * matches any run of
+// characters and ? a single one. Globs match the whole name.
+func compilePattern(pattern string) (*regexp.Regexp, error) {
+	expression := ""
+	if strings.HasPrefix(pattern, REGEX_PREFIX) {
+		expression = "(?i)" + strings.TrimPrefix(pattern, REGEX_PREFIX)
+	} else {
+		quoted := regexp.QuoteMeta(strings.TrimSpace(pattern))
+		quoted = strings.Replace(quoted, `\*`, ".*", -1)
+		quoted = strings.Replace(quoted, `\?`, ".", -1)
+		expression = "(?i)^\\s*" + quoted + "\\s*$"
+	}
+	compiled, err := regexp.Compile(expression)
+	if err != nil {
+		return nil, fmt.Errorf("invalid playlist pattern [pattern=%s][err=%v]", pattern, err)
+	}
+	return compiled, nil
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"io/ioutil"
+	"musicserviceclients"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+var selectionPlaylists = []musicserviceclients.Playlist{
+	{Name: "Road Trip", Id: "1"},
+	{Name: "road trip ", Id: "2"},
+	{Name: "Road Trip 2019", Id: "3"},
+	{Name: "Focus", Id: "4"},
+	{Name: "Discover Weekly", Id: "5"},
+	{Name: "Rock/Pop?", Id: "6"},
+}
+
+func TestPlaylistSelection(t *testing.T) {
+	tests := []struct {
+		name     string
+		names    []string
+		ids      []string
+		includes []string
+		excludes []string
+		selected []string
+		missing  []string
+	}{
+		{"name ignores case and spaces", []string{"ROAD TRIP"}, nil, nil, nil, []string{"1", "2"}, nil},
+		{"ambiguous name selects every playlist", []string{"Road Trip", "Focus"}, nil, nil, nil, []string{"1", "2", "4"}, nil},
+		{"id", nil, []string{"3"}, nil, nil, []string{"3"}, nil},
+		{"name and id", []string{"Focus"}, []string{"5"}, nil, nil, []string{"4", "5"}, nil},
+		{"glob star", nil, nil, []string{"road*"}, nil, []string{"1", "2", "3"}, nil},
+		{"glob question mark", nil, nil, []string{"Road Trip ????"}, nil, []string{"3"}, nil},
+		{"glob matches the whole name", nil, nil, []string{"Trip"}, nil, nil, nil},
+		{"glob quotes regex characters", nil, nil, []string{"Rock/Pop?"}, nil, []string{"6"}, nil},
+		{"regex", nil, nil, []string{`re:\d{4}$`}, nil, []string{"3"}, nil},
+		{"regex matches anywhere", nil, nil, []string{"re:weekly"}, nil, []string{"5"}, nil},
+		{"exclude only selects the rest", nil, nil, nil, []string{"road*"}, []string{"4", "5", "6"}, nil},
+		{"exclude wins over include", nil, nil, []string{"*"}, []string{"re:^road"}, []string{"4", "5", "6"}, nil},
+		{"all", []string{PLAYLIST_ALL}, nil, nil, nil, []string{"1", "2", "3", "4", "5", "6"}, nil},
+		{"no match", []string{"Gym"}, []string{"9"}, []string{"re:^x"}, nil, nil, []string{"name=Gym", "id=9"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			selection, err := newPlaylistSelection(test.names, test.ids, test.includes, test.excludes)
+			if err != nil {
+				t.Fatalf("newPlaylistSelection() failed [err=%v]", err)
+			}
+			var selected []string
+			var playlists []musicserviceclients.Playlist
+			for _, playlist := range selectionPlaylists {
+				if selection.matches(playlist.Name, playlist.Id) {
+					selected = append(selected, playlist.Id)
+					playlists = append(playlists, playlist)
+				}
+			}
+			if !reflect.DeepEqual(selected, test.selected) {
+				t.Errorf("selected %v, want %v", selected, test.selected)
+			}
+			if missing := selection.missing(playlists); !reflect.DeepEqual(missing, test.missing) {
+				t.Errorf("missing %v, want %v", missing, test.missing)
+			}
+		})
+	}
+}
+
+func TestPlaylistSelectionInvalidRegex(t *testing.T) {
+	for _, patterns := range [][]string{{"re:("}, {"*", "re:[a-"}} {
+		if _, err := newPlaylistSelection(nil, nil, patterns, nil); err == nil {
+			t.Errorf("newPlaylistSelection() accepted includes %v", patterns)
+		}
+		if _, err := newPlaylistSelection(nil, nil, nil, patterns); err == nil {
+			t.Errorf("newPlaylistSelection() accepted excludes %v", patterns)
+		}
+	}
+}
+
+func TestPlaylistSelectionEmpty(t *testing.T) {
+	tests := []struct {
+		name     string
+		names    []string
+		ids      []string
+		includes []string
+		excludes []string
+		empty    bool
+	}{
+		{"one name", []string{"Focus"}, nil, nil, nil, false},
+		{"name and exclude", []string{"Focus"}, nil, nil, []string{"x"}, false},
+		{"all", []string{PLAYLIST_ALL}, nil, nil, nil, false},
+		{"id", nil, []string{"1"}, nil, nil, false},
+		{"exclude only", nil, nil, nil, []string{"x"}, false},
+		{"nothing", nil, nil, nil, nil, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			selection, err := newPlaylistSelection(test.names, test.ids, test.includes, test.excludes)
+			if err != nil {
+				t.Fatalf("newPlaylistSelection() failed [err=%v]", err)
+			}
+			if empty := selection.empty(); empty != test.empty {
+				t.Errorf("empty() = %v, want %v", empty, test.empty)
+			}
+		})
+	}
+}
+
+// TestListPlaylistsSameName checks that a single name selects every playlist carrying it, not
+// only the first one the service returns.
+func TestListPlaylistsSameName(t *testing.T) {
+	directory := t.TempDir()
+	for file, name := range map[string]string{"a.m3u8": "Road Trip", "b.m3u8": "road trip", "c.m3u8": "Focus"} {
+		content := "#EXTM3U\n#PLAYLIST:" + name + "\n"
+		if err := ioutil.WriteFile(filepath.Join(directory, file), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	client := newLoggedInClient(t, musicserviceclients.SERVICE_FILE, musicserviceclients.ServiceConfig{Directory: directory})
+	selection, err := newPlaylistSelection([]string{"Road Trip"}, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("newPlaylistSelection() failed [err=%v]", err)
+	}
+	var ids []string
+	for _, playlist := range listPlaylists(client, musicserviceclients.SERVICE_FILE, selection) {
+		ids = append(ids, playlist.Id)
+	}
+	if expected := []string{"a.m3u8", "b.m3u8"}; !reflect.DeepEqual(ids, expected) {
+		t.Errorf("listPlaylists() = %v, want %v", ids, expected)
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"musicserviceclients"
+	"musicserviceclients/matcher"
+	"os"
+)
+
+type playlistDelta struct {
+	added        []musicserviceclients.Song
+	removed      []musicserviceclients.Song
+	unmigratable []musicserviceclients.Song
+}
+
+func syncPlaylists(destination destination, playlists []musicserviceclients.Playlist) {
+	for _, playlist := range playlists {
+		existing, err := destinationPlaylist(destination, playlist)
+		if errors.Is(err, musicserviceclients.ErrPlaylistNotFound) {
+			createPlaylists(destination, []musicserviceclients.Playlist{playlist})
+			continue
+		}
+		if err != nil {
+			log.Printf("Failed to list playlist for [name=%s, service=%s, err=%v]", playlist.Name, destination.service, err)
+			destination.recordPlaylist(playlist, "", nil, nil, err)
+			continue
+		}
+		destination.mapping.RecordPlaylist(playlist.Id, existing.Id)
+		songs, unmigratable := splitMigratable(playlist.Name, playlist.Songs)
+		delta := diffSongs(songs, existing.Songs, destination.mapping, destination.matcher)
+		delta.unmigratable = unmigratable
+		applyDelta(destination, playlist, *existing, delta)
+		destination.saveState()
+	}
+}
+
+// destinationPlaylist prefers the playlist recorded by an earlier run and falls back to a
+// lookup by name when there is none or it no longer exists.
+func destinationPlaylist(destination destination, playlist musicserviceclients.Playlist) (*musicserviceclients.Playlist, error) {
+	if id, ok := destination.mapping.DestinationPlaylist(playlist.Id); ok {
+		existing, err := destination.client.GetPlaylist(id)
+		if !errors.Is(err, musicserviceclients.ErrPlaylistNotFound) {
+			return existing, err
+		}
+	}
+	return destination.client.ListPlaylist(playlist.Name)
+}
+
+func applyDelta(destination destination, source, playlist musicserviceclients.Playlist, delta playlistDelta) {
+	log.Printf("Syncing Playlist %s [added=%d, removed=%d]", playlist.Name, len(delta.added), len(delta.removed))
+	var errorList []error
+	if len(delta.removed) > 0 {
+		err := destination.client.RemoveTracks(playlist.Id, delta.removed)
+		if err != nil {
+			log.Printf("Failed to remove songs for [name=%s, service=%s, err=%v]", playlist.Name, destination.service, err)
+			logFailures(playlist.Name, err)
+			errorList = append(errorList, err)
+		}
+	}
+	var matches []musicserviceclients.TrackMatch
+	if len(delta.added) > 0 {
+		var err error
+		matches, err = destination.client.AddTracks(playlist.Id, delta.added)
+		if err != nil {
+			log.Printf("Failed to add songs for [name=%s, service=%s, err=%v]", playlist.Name, destination.service, err)
+			logFailures(playlist.Name, err)
+			errorList = append(errorList, err)
+		}
+	}
+	destination.recordPlaylist(source, playlist.Id, matches, delta.removed, errors.Join(errorList...))
+	if destination.dryRun {
+		printPlan(os.Stdout, playlist.Name, matches, delta.removed, delta.unmigratable)
+	}
+}
+
+// diffSongs pairs every source song with at most one destination song, first through the
+// track recorded in mapping, then by SongKey and last by the best destination song trackMatcher
+// accepts, so duplicates on either side are matched one to one and a track that was matched to
+// a differently titled release, such as a remaster, is kept. Unpaired source songs are added and
+// unpaired destination songs are removed, except for local files and other items that could
+// not be added back.
+func diffSongs(source, destination []musicserviceclients.Song, mapping musicserviceclients.TrackMapping, trackMatcher *matcher.Matcher) playlistDelta {
+	var delta playlistDelta
+	byId := make(map[string][]int)
+	byKey := make(map[string][]int)
+	for i, song := range destination {
+		if len(song.Id) > 0 {
+			byId[song.Id] = append(byId[song.Id], i)
+		}
+		key := musicserviceclients.SongKey(song)
+		byKey[key] = append(byKey[key], i)
+	}
+	paired := make([]bool, len(destination))
+	pair := func(candidates []int) bool {
+		for _, i := range candidates {
+			if !paired[i] {
+				paired[i] = true
+				return true
+			}
+		}
+		return false
+	}
+	var unpaired []musicserviceclients.Song
+	for _, song := range source {
+		if mapping != nil {
+			if id, ok := mapping.DestinationTrack(song); ok && pair(byId[id]) {
+				continue
+			}
+		}
+		if !pair(byKey[musicserviceclients.SongKey(song)]) {
+			unpaired = append(unpaired, song)
+		}
+	}
+	if trackMatcher == nil {
+		trackMatcher = matcher.NewMatcher(matcher.DEFAULT_THRESHOLD)
+	}
+	for _, song := range unpaired {
+		best, bestScore := -1, 0.0
+		for i, candidate := range destination {
+			if paired[i] || len(candidate.Unmigratable) > 0 {
+				continue
+			}
+			if score := trackMatcher.Score(musicserviceclients.MatchTrack(song), musicserviceclients.MatchTrack(candidate)); score >= trackMatcher.Threshold && score > bestScore {
+				best, bestScore = i, score
+			}
+		}
+		if best >= 0 {
+			paired[best] = true
+		} else {
+			delta.added = append(delta.added, song)
+		}
+	}
+	for i, song := range destination {
+		if !paired[i] && len(song.Unmigratable) == 0 {
+			delta.removed = append(delta.removed, song)
+		}
+	}
+	return delta
+}
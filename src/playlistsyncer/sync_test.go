@@ -0,0 +1,83 @@
+package main
+
+import (
+	"musicserviceclients"
+	"musicserviceclients/matcher"
+	"reflect"
+	"testing"
+)
+
+type mapTrackMapping map[string]string
+
+func (m mapTrackMapping) DestinationTrack(song musicserviceclients.Song) (string, bool) {
+	id, ok := m[song.Id]
+	return id, ok
+}
+
+func (m mapTrackMapping) RecordTrack(song musicserviceclients.Song, id string) {
+	m[song.Id] = id
+}
+
+func testSong(id, artist, name string) musicserviceclients.Song {
+	return musicserviceclients.Song{Id: id, Name: name, Artists: []musicserviceclients.Artist{{Name: artist}}}
+}
+
+func TestDiffSongs(t *testing.T) {
+	dreams := testSong("s1", "Fleetwood Mac", "Dreams")
+	takeOnMe := testSong("s2", "a-ha", "Take On Me")
+	brightside := testSong("s3", "The Killers", "Mr. Brightside")
+	destDreams := testSong("d1", "Fleetwood Mac", "Dreams")
+	destTakeOnMe := testSong("d2", "A-HA", "take on me")
+	destBrightside := testSong("d3", "The Killers", "Mr. Brightside")
+	localFile := musicserviceclients.Song{Name: "Demo", Unmigratable: musicserviceclients.UNMIGRATABLE_LOCAL_FILE}
+	tests := []struct {
+		name        string
+		source      []musicserviceclients.Song
+		destination []musicserviceclients.Song
+		mapping     mapTrackMapping
+		added       []musicserviceclients.Song
+		removed     []musicserviceclients.Song
+	}{
+		{"in sync", []musicserviceclients.Song{dreams, takeOnMe}, []musicserviceclients.Song{destDreams, destTakeOnMe}, nil, nil, nil},
+		{"reordered", []musicserviceclients.Song{takeOnMe, brightside, dreams}, []musicserviceclients.Song{destDreams, destTakeOnMe, destBrightside}, nil, nil, nil},
+		{"added", []musicserviceclients.Song{dreams, takeOnMe, brightside}, []musicserviceclients.Song{destTakeOnMe}, nil,
+			[]musicserviceclients.Song{dreams, brightside}, nil},
+		{"removed", []musicserviceclients.Song{takeOnMe}, []musicserviceclients.Song{destDreams, destTakeOnMe, destBrightside}, nil,
+			nil, []musicserviceclients.Song{destDreams, destBrightside}},
+		{"duplicate in source", []musicserviceclients.Song{dreams, dreams, takeOnMe}, []musicserviceclients.Song{destDreams, destTakeOnMe}, nil,
+			[]musicserviceclients.Song{dreams}, nil},
+		{"duplicate in destination", []musicserviceclients.Song{dreams, takeOnMe}, []musicserviceclients.Song{destDreams, destTakeOnMe, destDreams}, nil,
+			nil, []musicserviceclients.Song{destDreams}},
+		{"duplicates on both sides", []musicserviceclients.Song{dreams, takeOnMe, dreams}, []musicserviceclients.Song{destDreams, destDreams, destTakeOnMe}, nil, nil, nil},
+		{"mapping pairs renamed tracks", []musicserviceclients.Song{dreams}, []musicserviceclients.Song{testSong("d9", "Fleetwood Mac", "Dreams (2004 Remaster)")},
+			mapTrackMapping{"s1": "d9"}, nil, nil},
+		{"mapping falls back to the key", []musicserviceclients.Song{dreams, dreams}, []musicserviceclients.Song{destDreams, testSong("d9", "Fleetwood Mac", "Dreams - Live")},
+			mapTrackMapping{"s1": "d9"}, nil, nil},
+		{"mapped track is paired once", []musicserviceclients.Song{dreams, dreams}, []musicserviceclients.Song{testSong("d9", "Fleetwood Mac", "Dreams - Live")},
+			mapTrackMapping{"s1": "d9"}, []musicserviceclients.Song{dreams}, nil},
+		{"remaster is paired by score", []musicserviceclients.Song{testSong("s4", "Fleetwood Mac", "Go Your Own Way"), takeOnMe},
+			[]musicserviceclients.Song{destTakeOnMe, testSong("d4", "Fleetwood Mac", "Go Your Own Way - 2004 Remaster")}, nil, nil, nil},
+		{"best scoring destination song is paired", []musicserviceclients.Song{testSong("s4", "Fleetwood Mac", "Go Your Own Way")},
+			[]musicserviceclients.Song{testSong("d5", "Fleetwood Mac", "Go Your Own Way (Live)"), testSong("d4", "Fleetwood Mac", "Go Your Own Way - 2004 Remaster")}, nil,
+			nil, []musicserviceclients.Song{testSong("d5", "Fleetwood Mac", "Go Your Own Way (Live)")}},
+		{"different song below the threshold is replaced", []musicserviceclients.Song{dreams}, []musicserviceclients.Song{testSong("d6", "Fleetwood Mac", "Landslide")}, nil,
+			[]musicserviceclients.Song{dreams}, []musicserviceclients.Song{testSong("d6", "Fleetwood Mac", "Landslide")}},
+		{"unmigratable destination songs are kept", []musicserviceclients.Song{takeOnMe}, []musicserviceclients.Song{localFile, destTakeOnMe}, nil, nil, nil},
+		{"empty destination", []musicserviceclients.Song{dreams, takeOnMe}, nil, nil, []musicserviceclients.Song{dreams, takeOnMe}, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var mapping musicserviceclients.TrackMapping
+			if test.mapping != nil {
+				mapping = test.mapping
+			}
+			delta := diffSongs(test.source, test.destination, mapping, matcher.NewMatcher(matcher.DEFAULT_THRESHOLD))
+			if !reflect.DeepEqual(delta.added, test.added) {
+				t.Errorf("added %v, want %v", delta.added, test.added)
+			}
+			if !reflect.DeepEqual(delta.removed, test.removed) {
+				t.Errorf("removed %v, want %v", delta.removed, test.removed)
+			}
+		})
+	}
+}
@@ -0,0 +1,259 @@
+package report
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"musicserviceclients"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	FORMAT_JSON = "json"
+	FORMAT_CSV  = "csv"
+	FORMAT_HTML = "html"
+)
+
+const (
+	STATUS_REMOVED      = "removed"
+	STATUS_UNMIGRATABLE = "unmigratable"
+)
+
+type Track struct {
+	Id          string   `json:"id,omitempty"`
+	Name        string   `json:"name"`
+	Artists     []string `json:"artists"`
+	Album       string   `json:"album,omitempty"`
+	DurationMs  int64    `json:"durationMs,omitempty"`
+	Isrc        string   `json:"isrc,omitempty"`
+	DiscNumber  int      `json:"discNumber,omitempty"`
+	TrackNumber int      `json:"trackNumber,omitempty"`
+	Explicit    bool     `json:"explicit,omitempty"`
+	Year        int      `json:"year,omitempty"`
+}
+
+type Song struct {
+	Source      *Track  `json:"source,omitempty"`
+	Destination *Track  `json:"destination,omitempty"`
+	Status      string  `json:"status"`
+	Score       float64 `json:"score"`
+	Mapped      bool    `json:"mapped,omitempty"`
+	Reason      string  `json:"reason,omitempty"`
+	Error       string  `json:"error,omitempty"`
+}
+
+type Playlist struct {
+	Name          string `json:"name"`
+	SourceId      string `json:"sourceId,omitempty"`
+	DestinationId string `json:"destinationId,omitempty"`
+	Error         string `json:"error,omitempty"`
+	Songs         []Song `json:"songs"`
+}
+
+// Report records how every song of a run was matched. It is safe for concurrent use.
+type Report struct {
+	Source      string     `json:"source"`
+	Destination string     `json:"destination"`
+	DryRun      bool       `json:"dryRun"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	Playlists   []Playlist `json:"playlists"`
+	mu          sync.Mutex
+}
+
+func New(source, destination string, dryRun bool) *Report {
+	return &Report{Source: source, Destination: destination, DryRun: dryRun, CreatedAt: time.Now().UTC(), Playlists: []Playlist{}}
+}
+
+// AddPlaylist records the matches of a playlist, the songs removed from it, the source songs
+// that were skipped as unmigratable and the error the destination returned for it, if any.
+func (r *Report) AddPlaylist(source musicserviceclients.Playlist, destinationId string, matches []musicserviceclients.TrackMatch, removed []musicserviceclients.Song, err error) {
+	playlist := Playlist{Name: source.Name, SourceId: source.Id, DestinationId: destinationId, Songs: []Song{}}
+	if err != nil {
+		playlist.Error = err.Error()
+	}
+	for _, match := range matches {
+		source := reportTrack(match.Source)
+		song := Song{Source: &source, Status: string(match.Status), Score: match.Score, Mapped: match.Mapped}
+		if match.Track != nil {
+			destination := reportTrack(*match.Track)
+			song.Destination = &destination
+		}
+		if match.Err != nil {
+			song.Error = match.Err.Error()
+		}
+		var songErr *musicserviceclients.SongError
+		if errors.As(match.Err, &songErr) {
+			song.Reason = string(songErr.Reason)
+		}
+		playlist.Songs = append(playlist.Songs, song)
+	}
+	for _, removedSong := range removed {
+		destination := reportTrack(removedSong)
+		playlist.Songs = append(playlist.Songs, Song{Destination: &destination, Status: STATUS_REMOVED})
+	}
+	for _, sourceSong := range source.Songs {
+		if len(sourceSong.Unmigratable) > 0 {
+			source := reportTrack(sourceSong)
+			playlist.Songs = append(playlist.Songs, Song{Source: &source, Status: STATUS_UNMIGRATABLE, Reason: string(sourceSong.Unmigratable)})
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Playlists = append(r.Playlists, playlist)
+}
+
+// Format derives the report format from the file extension of path.
+func Format(path string) (string, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return FORMAT_JSON, nil
+	case ".csv":
+		return FORMAT_CSV, nil
+	case ".html", ".htm":
+		return FORMAT_HTML, nil
+	default:
+		return "", fmt.Errorf("unsupported report file extension [path=%s]", path)
+	}
+}
+
+func Write(path, format string, report *Report) error {
+	content, err := Encode(report, format)
+	if err != nil {
+		return fmt.Errorf("failed to encode report [path=%s][err=%v]", path, err)
+	}
+	err = ioutil.WriteFile(path, content, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to write report [path=%s][err=%v]", path, err)
+	}
+	return nil
+}
+
+func Encode(report *Report, format string) ([]byte, error) {
+	report.mu.Lock()
+	defer report.mu.Unlock()
+	switch format {
+	case FORMAT_JSON:
+		return json.MarshalIndent(report, "", "  ")
+	case FORMAT_CSV:
+		return encodeCsv(report)
+	case FORMAT_HTML:
+		return encodeHtml(report)
+	default:
+		return nil, fmt.Errorf("unsupported report format [format=%s]", format)
+	}
+}
+
+var csvHeader = []string{
+	"playlist", "status", "score",
+	"source_id", "source_name", "source_artists", "source_album", "source_isrc", "source_duration_ms",
+	"destination_id", "destination_name", "destination_artists", "destination_album", "mapped", "reason", "error",
+}
+
+// encodeCsv writes one row per song. Playlists that failed as a whole get a row of their own
+// with an empty status.
+func encodeCsv(report *Report) ([]byte, error) {
+	var buffer bytes.Buffer
+	writer := csv.NewWriter(&buffer)
+	writer.Write(csvHeader)
+	for _, playlist := range report.Playlists {
+		if len(playlist.Error) > 0 {
+			writer.Write([]string{playlist.Name, "", "", "", "", "", "", "", "", playlist.DestinationId, "", "", "", "", "", playlist.Error})
+		}
+		for _, song := range playlist.Songs {
+			source, destination := Track{}, Track{}
+			if song.Source != nil {
+				source = *song.Source
+			}
+			if song.Destination != nil {
+				destination = *song.Destination
+			}
+			duration := ""
+			if source.DurationMs > 0 {
+				duration = strconv.FormatInt(source.DurationMs, 10)
+			}
+			writer.Write([]string{
+				playlist.Name, song.Status, strconv.FormatFloat(song.Score, 'f', 2, 64),
+				source.Id, source.Name, strings.Join(source.Artists, "; "), source.Album, source.Isrc, duration,
+				destination.Id, destination.Name, strings.Join(destination.Artists, "; "), destination.Album, strconv.FormatBool(song.Mapped), song.Reason, song.Error})
+		}
+	}
+	writer.Flush()
+	return buffer.Bytes(), writer.Error()
+}
+
+var htmlTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"join":  strings.Join,
+	"class": func(status string) string { return strings.Replace(status, " ", "-", -1) },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Playlist migration {{.Source}} to {{.Destination}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; width: 100%; margin-bottom: 2em; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; vertical-align: top; }
+th { background: #eee; }
+.matched { background: #e8f5e9; }
+.ambiguous { background: #fff8e1; }
+.not-found, .failed { background: #ffebee; }
+.removed, .unmigratable { background: #eceff1; }
+.error { color: #b71c1c; }
+</style>
+</head>
+<body>
+<h1>Playlist migration {{.Source}} to {{.Destination}}{{if .DryRun}} (dry run){{end}}</h1>
+<p>Created {{.CreatedAt.Format "2006-01-02 15:04:05 MST"}}</p>
+{{range .Playlists}}
+<h2>{{.Name}}</h2>
+{{if .Error}}<p class="error">{{.Error}}</p>{{end}}
+<table>
+<tr><th>Status</th><th>Score</th><th>Source</th><th>Source album</th><th>ISRC</th><th>Destination</th><th>Destination id</th><th>Reason</th><th>Error</th></tr>
+{{range .Songs}}<tr class="{{class .Status}}">
+<td>{{.Status}}</td>
+<td>{{printf "%.2f" .Score}}</td>
+<td>{{with .Source}}{{join .Artists ", "}}{{if .Artists}} - {{end}}{{.Name}}{{end}}</td>
+<td>{{with .Source}}{{.Album}}{{end}}</td>
+<td>{{with .Source}}{{.Isrc}}{{end}}</td>
+<td>{{if .Mapped}}recorded mapping{{else}}{{with .Destination}}{{join .Artists ", "}}{{if .Artists}} - {{end}}{{.Name}}{{end}}{{end}}</td>
+<td>{{with .Destination}}{{.Id}}{{end}}</td>
+<td>{{.Reason}}</td>
+<td class="error">{{.Error}}</td>
+</tr>
+{{end}}</table>
+{{end}}
+</body>
+</html>
+`))
+
+func encodeHtml(report *Report) ([]byte, error) {
+	var buffer bytes.Buffer
+	err := htmlTemplate.Execute(&buffer, report)
+	return buffer.Bytes(), err
+}
+
+func reportTrack(song musicserviceclients.Song) Track {
+	track := Track{
+		Id:          song.Id,
+		Name:        song.Name,
+		Album:       song.Album.Name,
+		Artists:     []string{},
+		DurationMs:  int64(song.Duration / time.Millisecond),
+		Isrc:        song.Isrc,
+		DiscNumber:  song.DiscNumber,
+		TrackNumber: song.TrackNumber,
+		Explicit:    song.Explicit,
+		Year:        song.Year}
+	for _, artist := range song.Artists {
+		track.Artists = append(track.Artists, artist.Name)
+	}
+	return track
+}
@@ -0,0 +1,126 @@
+package report
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"musicserviceclients"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+var songErr = &musicserviceclients.SongError{
+	Song:   musicserviceclients.Song{Name: `<script>alert("x")</script>`},
+	Reason: musicserviceclients.REASON_NOT_FOUND,
+	Err:    errors.New("no track found")}
+
+func newTestReport() *Report {
+	report := New(musicserviceclients.SERVICE_GOOGLE_PLAY_MUSIC, musicserviceclients.SERVICE_SPOTIFY, false)
+	report.CreatedAt = time.Date(2020, 5, 17, 10, 30, 0, 0, time.UTC)
+	source := musicserviceclients.Playlist{Name: "Road Trip", Id: "source-playlist"}
+	matches := []musicserviceclients.TrackMatch{
+		{
+			Source: musicserviceclients.Song{Id: "src-1", Name: "Rock & Roll", Artists: []musicserviceclients.Artist{{Name: "Led Zeppelin"}},
+				Album: musicserviceclients.Album{Name: "Led Zeppelin IV"}, Isrc: "GBUM71029604", Duration: 220 * time.Second},
+			Track: &musicserviceclients.Song{Id: "dst-1", Name: "Rock and Roll - Remaster", Artists: []musicserviceclients.Artist{{Name: "Led Zeppelin"}},
+				Album: musicserviceclients.Album{Name: "Led Zeppelin IV (Remaster)"}},
+			Score:  0.92,
+			Status: musicserviceclients.MATCH_MATCHED},
+		{
+			Source: musicserviceclients.Song{Id: "src-2", Name: `<script>alert("x")</script>`,
+				Artists: []musicserviceclients.Artist{{Name: "Bobby Tables"}, {Name: "Mallory"}}},
+			Status: musicserviceclients.MATCH_FAILED,
+			Err:    songErr},
+	}
+	report.AddPlaylist(source, "destination-playlist", matches, nil, nil)
+	return report
+}
+
+func writeTestReport(t *testing.T, name string) []byte {
+	path := filepath.Join(t.TempDir(), name)
+	format, err := Format(path)
+	if err != nil {
+		t.Fatalf("Format() failed [err=%v]", err)
+	}
+	if err := Write(path, format, newTestReport()); err != nil {
+		t.Fatalf("Write() failed [err=%v]", err)
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return content
+}
+
+func TestReportJson(t *testing.T) {
+	var decoded Report
+	if err := json.Unmarshal(writeTestReport(t, "report.json"), &decoded); err != nil {
+		t.Fatalf("failed to parse report [err=%v]", err)
+	}
+	expected := []Playlist{{
+		Name:          "Road Trip",
+		SourceId:      "source-playlist",
+		DestinationId: "destination-playlist",
+		Songs: []Song{
+			{
+				Source:      &Track{Id: "src-1", Name: "Rock & Roll", Artists: []string{"Led Zeppelin"}, Album: "Led Zeppelin IV", Isrc: "GBUM71029604", DurationMs: 220000},
+				Destination: &Track{Id: "dst-1", Name: "Rock and Roll - Remaster", Artists: []string{"Led Zeppelin"}, Album: "Led Zeppelin IV (Remaster)"},
+				Status:      "matched",
+				Score:       0.92},
+			{
+				Source: &Track{Id: "src-2", Name: `<script>alert("x")</script>`, Artists: []string{"Bobby Tables", "Mallory"}},
+				Status: "failed",
+				Reason: "not found",
+				Error:  songErr.Error()},
+		}}}
+	if decoded.Source != musicserviceclients.SERVICE_GOOGLE_PLAY_MUSIC || decoded.Destination != musicserviceclients.SERVICE_SPOTIFY || decoded.DryRun {
+		t.Errorf("decoded [source=%s][destination=%s][dryRun=%t]", decoded.Source, decoded.Destination, decoded.DryRun)
+	}
+	if !reflect.DeepEqual(decoded.Playlists, expected) {
+		t.Errorf("decoded playlists\n%+v\nwant\n%+v", decoded.Playlists, expected)
+	}
+}
+
+func TestReportCsv(t *testing.T) {
+	records, err := csv.NewReader(strings.NewReader(string(writeTestReport(t, "report.csv")))).ReadAll()
+	if err != nil {
+		t.Fatalf("failed to parse report [err=%v]", err)
+	}
+	expected := [][]string{
+		{"playlist", "status", "score",
+			"source_id", "source_name", "source_artists", "source_album", "source_isrc", "source_duration_ms",
+			"destination_id", "destination_name", "destination_artists", "destination_album", "mapped", "reason", "error"},
+		{"Road Trip", "matched", "0.92",
+			"src-1", "Rock & Roll", "Led Zeppelin", "Led Zeppelin IV", "GBUM71029604", "220000",
+			"dst-1", "Rock and Roll - Remaster", "Led Zeppelin", "Led Zeppelin IV (Remaster)", "false", "", ""},
+		{"Road Trip", "failed", "0.00",
+			"src-2", `<script>alert("x")</script>`, "Bobby Tables; Mallory", "", "", "",
+			"", "", "", "", "false", "not found", songErr.Error()},
+	}
+	if !reflect.DeepEqual(records, expected) {
+		t.Errorf("csv records\n%q\nwant\n%q", records, expected)
+	}
+}
+
+func TestReportHtml(t *testing.T) {
+	content := string(writeTestReport(t, "report.html"))
+	for _, expected := range []string{
+		"<h2>Road Trip</h2>",
+		`<tr class="matched">`,
+		`<tr class="failed">`,
+		"Led Zeppelin - Rock &amp; Roll",
+		"Led Zeppelin - Rock and Roll - Remaster",
+		"Bobby Tables, Mallory - &lt;script&gt;alert(&#34;x&#34;)&lt;/script&gt;",
+	} {
+		if !strings.Contains(content, expected) {
+			t.Errorf("html report does not contain %s:\n%s", expected, content)
+		}
+	}
+	if strings.Contains(content, "<script>") {
+		t.Errorf("html report does not escape song names:\n%s", content)
+	}
+}
@@ -0,0 +1,236 @@
+package snapshot
+
+import (
+	"encoding/json"
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"musicserviceclients"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const SCHEMA_VERSION = 1
+
+const (
+	FORMAT_JSON = "json"
+	FORMAT_YAML = "yaml"
+)
+
+type Artist struct {
+	Name string `json:"name" yaml:"name"`
+	Id   string `json:"id,omitempty" yaml:"id,omitempty"`
+}
+
+type Album struct {
+	Name    string   `json:"name" yaml:"name"`
+	Upc     string   `json:"upc,omitempty" yaml:"upc,omitempty"`
+	Id      string   `json:"id,omitempty" yaml:"id,omitempty"`
+	Artists []Artist `json:"artists,omitempty" yaml:"artists,omitempty"`
+}
+
+type ServiceId struct {
+	Id  string `json:"id" yaml:"id"`
+	Uri string `json:"uri,omitempty" yaml:"uri,omitempty"`
+}
+
+type Song struct {
+	Id           string               `json:"id,omitempty" yaml:"id,omitempty"`
+	Name         string               `json:"name" yaml:"name"`
+	Album        Album                `json:"album" yaml:"album"`
+	Artists      []Artist             `json:"artists" yaml:"artists"`
+	DurationMs   int64                `json:"durationMs,omitempty" yaml:"durationMs,omitempty"`
+	Isrc         string               `json:"isrc,omitempty" yaml:"isrc,omitempty"`
+	DiscNumber   int                  `json:"discNumber,omitempty" yaml:"discNumber,omitempty"`
+	TrackNumber  int                  `json:"trackNumber,omitempty" yaml:"trackNumber,omitempty"`
+	Explicit     bool                 `json:"explicit,omitempty" yaml:"explicit,omitempty"`
+	Year         int                  `json:"year,omitempty" yaml:"year,omitempty"`
+	ServiceIds   map[string]ServiceId `json:"serviceIds,omitempty" yaml:"serviceIds,omitempty"`
+	Unmigratable string               `json:"unmigratable,omitempty" yaml:"unmigratable,omitempty"`
+}
+
+type Playlist struct {
+	Id            string `json:"id,omitempty" yaml:"id,omitempty"`
+	Name          string `json:"name" yaml:"name"`
+	Description   string `json:"description,omitempty" yaml:"description,omitempty"`
+	Visibility    string `json:"visibility,omitempty" yaml:"visibility,omitempty"`
+	Collaborative bool   `json:"collaborative,omitempty" yaml:"collaborative,omitempty"`
+	CoverImageUrl string `json:"coverImageUrl,omitempty" yaml:"coverImageUrl,omitempty"`
+	Songs         []Song `json:"songs" yaml:"songs"`
+}
+
+// Library is the on-disk representation of a set of playlists exported from a service.
+type Library struct {
+	SchemaVersion int        `json:"schemaVersion" yaml:"schemaVersion"`
+	Source        string     `json:"source,omitempty" yaml:"source,omitempty"`
+	CreatedAt     time.Time  `json:"createdAt" yaml:"createdAt"`
+	Playlists     []Playlist `json:"playlists" yaml:"playlists"`
+}
+
+func NewLibrary(source string, playlists []musicserviceclients.Playlist) *Library {
+	library := &Library{SchemaVersion: SCHEMA_VERSION, Source: source, CreatedAt: time.Now().UTC()}
+	for _, playlist := range playlists {
+		library.Playlists = append(library.Playlists, snapshotPlaylist(playlist))
+	}
+	return library
+}
+
+func (l *Library) MediaPlaylists() []musicserviceclients.Playlist {
+	var playlists []musicserviceclients.Playlist
+	for _, playlist := range l.Playlists {
+		playlists = append(playlists, mediaPlaylist(playlist))
+	}
+	return playlists
+}
+
+// Format derives the snapshot format from the file extension of path.
+func Format(path string) (string, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return FORMAT_JSON, nil
+	case ".yaml", ".yml":
+		return FORMAT_YAML, nil
+	default:
+		return "", fmt.Errorf("unsupported snapshot file extension [path=%s]", path)
+	}
+}
+
+func Read(path string) (*Library, error) {
+	format, err := Format(path)
+	if err != nil {
+		return nil, err
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot [path=%s][err=%v]", path, err)
+	}
+	library, err := Decode(content, format)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode snapshot [path=%s][err=%v]", path, err)
+	}
+	return library, nil
+}
+
+func Write(path string, library *Library) error {
+	format, err := Format(path)
+	if err != nil {
+		return err
+	}
+	content, err := Encode(library, format)
+	if err != nil {
+		return fmt.Errorf("failed to encode snapshot [path=%s][err=%v]", path, err)
+	}
+	err = ioutil.WriteFile(path, content, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to write snapshot [path=%s][err=%v]", path, err)
+	}
+	return nil
+}
+
+func Encode(library *Library, format string) ([]byte, error) {
+	switch format {
+	case FORMAT_JSON:
+		return json.MarshalIndent(library, "", "  ")
+	case FORMAT_YAML:
+		return yaml.Marshal(library)
+	default:
+		return nil, fmt.Errorf("unsupported snapshot format [format=%s]", format)
+	}
+}
+
+func Decode(content []byte, format string) (*Library, error) {
+	var library Library
+	var err error
+	switch format {
+	case FORMAT_JSON:
+		err = json.Unmarshal(content, &library)
+	case FORMAT_YAML:
+		err = yaml.Unmarshal(content, &library)
+	default:
+		err = fmt.Errorf("unsupported snapshot format [format=%s]", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if library.SchemaVersion < 1 || library.SchemaVersion > SCHEMA_VERSION {
+		return nil, fmt.Errorf("unsupported snapshot schema version [version=%d][supported=%d]", library.SchemaVersion, SCHEMA_VERSION)
+	}
+	return &library, nil
+}
+
+func snapshotPlaylist(playlist musicserviceclients.Playlist) Playlist {
+	snapshot := Playlist{
+		Id:            playlist.Id,
+		Name:          playlist.Name,
+		Description:   playlist.Description,
+		Visibility:    string(playlist.Visibility),
+		Collaborative: playlist.Collaborative,
+		CoverImageUrl: playlist.CoverImageUrl,
+		Songs:         []Song{}}
+	for _, song := range playlist.Songs {
+		snapshotSong := Song{
+			Id:           song.Id,
+			Name:         song.Name,
+			Album:        Album{Name: song.Album.Name, Upc: song.Album.Upc, Id: song.Album.Id},
+			Artists:      []Artist{},
+			DurationMs:   int64(song.Duration / time.Millisecond),
+			Isrc:         song.Isrc,
+			DiscNumber:   song.DiscNumber,
+			TrackNumber:  song.TrackNumber,
+			Explicit:     song.Explicit,
+			Year:         song.Year,
+			Unmigratable: string(song.Unmigratable)}
+		for _, artist := range song.Artists {
+			snapshotSong.Artists = append(snapshotSong.Artists, Artist{Name: artist.Name, Id: artist.Id})
+		}
+		for _, artist := range song.Album.Artists {
+			snapshotSong.Album.Artists = append(snapshotSong.Album.Artists, Artist{Name: artist.Name, Id: artist.Id})
+		}
+		for service, serviceId := range song.ServiceIds {
+			if snapshotSong.ServiceIds == nil {
+				snapshotSong.ServiceIds = make(map[string]ServiceId)
+			}
+			snapshotSong.ServiceIds[service] = ServiceId{Id: serviceId.Id, Uri: serviceId.Uri}
+		}
+		snapshot.Songs = append(snapshot.Songs, snapshotSong)
+	}
+	return snapshot
+}
+
+func mediaPlaylist(snapshot Playlist) musicserviceclients.Playlist {
+	playlist := musicserviceclients.Playlist{
+		Id:            snapshot.Id,
+		Name:          snapshot.Name,
+		Description:   snapshot.Description,
+		Visibility:    musicserviceclients.Visibility(snapshot.Visibility),
+		Collaborative: snapshot.Collaborative,
+		CoverImageUrl: snapshot.CoverImageUrl}
+	for _, snapshotSong := range snapshot.Songs {
+		song := musicserviceclients.Song{
+			Id:           snapshotSong.Id,
+			Name:         snapshotSong.Name,
+			Album:        musicserviceclients.Album{Name: snapshotSong.Album.Name, Upc: snapshotSong.Album.Upc, Id: snapshotSong.Album.Id},
+			Duration:     time.Duration(snapshotSong.DurationMs) * time.Millisecond,
+			Isrc:         snapshotSong.Isrc,
+			DiscNumber:   snapshotSong.DiscNumber,
+			TrackNumber:  snapshotSong.TrackNumber,
+			Explicit:     snapshotSong.Explicit,
+			Year:         snapshotSong.Year,
+			Unmigratable: musicserviceclients.UnmigratableReason(snapshotSong.Unmigratable)}
+		for _, artist := range snapshotSong.Artists {
+			song.Artists = append(song.Artists, musicserviceclients.Artist{Name: artist.Name, Id: artist.Id})
+		}
+		for _, artist := range snapshotSong.Album.Artists {
+			song.Album.Artists = append(song.Album.Artists, musicserviceclients.Artist{Name: artist.Name, Id: artist.Id})
+		}
+		for service, serviceId := range snapshotSong.ServiceIds {
+			if song.ServiceIds == nil {
+				song.ServiceIds = make(map[string]musicserviceclients.ServiceId)
+			}
+			song.ServiceIds[service] = musicserviceclients.ServiceId{Id: serviceId.Id, Uri: serviceId.Uri}
+		}
+		playlist.Songs = append(playlist.Songs, song)
+	}
+	return playlist
+}
@@ -0,0 +1,118 @@
+package snapshot
+
+import (
+	"io/ioutil"
+	"musicserviceclients"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+var snapshotPlaylists = []musicserviceclients.Playlist{
+	{
+		Name:        "Road Trip",
+		Description: "Songs for the drive",
+		Id:          "playlist-1",
+		Visibility:  musicserviceclients.VISIBILITY_PUBLIC,
+		Songs: []musicserviceclients.Song{
+			{
+				Name: "Song 2",
+				Id:   "song-1",
+				Album: musicserviceclients.Album{
+					Name:    "Blur",
+					Id:      "album-1",
+					Upc:     "0724385500502",
+					Artists: []musicserviceclients.Artist{{Name: "Blur", Id: "artist-1"}}},
+				Artists:     []musicserviceclients.Artist{{Name: "Blur", Id: "artist-1"}},
+				Duration:    122 * time.Second,
+				Isrc:        "GBAYE9600045",
+				DiscNumber:  1,
+				TrackNumber: 2,
+				Year:        1997,
+				ServiceIds: map[string]musicserviceclients.ServiceId{
+					musicserviceclients.SERVICE_SPOTIFY: {Id: "spotify-1", Uri: "spotify:track:spotify-1"}}},
+			{
+				Name:         "Under Pressure",
+				Id:           "song-2",
+				Album:        musicserviceclients.Album{Name: "Hot Space"},
+				Artists:      []musicserviceclients.Artist{{Name: "Queen"}, {Name: "David Bowie"}},
+				Unmigratable: musicserviceclients.UNMIGRATABLE_LOCAL_FILE},
+		}},
+	{Name: "Empty", Id: "playlist-2"},
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	for _, format := range []string{FORMAT_JSON, FORMAT_YAML} {
+		t.Run(format, func(t *testing.T) {
+			library := NewLibrary(musicserviceclients.SERVICE_SPOTIFY, snapshotPlaylists)
+			content, err := Encode(library, format)
+			if err != nil {
+				t.Fatalf("Encode() failed [err=%v]", err)
+			}
+			decoded, err := Decode(content, format)
+			if err != nil {
+				t.Fatalf("Decode() failed [err=%v]", err)
+			}
+			if decoded.SchemaVersion != SCHEMA_VERSION || decoded.Source != library.Source {
+				t.Errorf("decoded [version=%d][source=%s], want [version=%d][source=%s]",
+					decoded.SchemaVersion, decoded.Source, SCHEMA_VERSION, library.Source)
+			}
+			if !decoded.CreatedAt.Equal(library.CreatedAt) {
+				t.Errorf("decoded createdAt %v, want %v", decoded.CreatedAt, library.CreatedAt)
+			}
+			if playlists := decoded.MediaPlaylists(); !reflect.DeepEqual(playlists, snapshotPlaylists) {
+				t.Errorf("decoded playlists %+v, want %+v", playlists, snapshotPlaylists)
+			}
+		})
+	}
+}
+
+func TestSnapshotWriteRead(t *testing.T) {
+	dir, err := ioutil.TempDir("", "snapshot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"library.json", "library.yaml", "library.yml"} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(dir, name)
+			if err := Write(path, NewLibrary(musicserviceclients.SERVICE_SPOTIFY, snapshotPlaylists)); err != nil {
+				t.Fatalf("Write() failed [err=%v]", err)
+			}
+			library, err := Read(path)
+			if err != nil {
+				t.Fatalf("Read() failed [err=%v]", err)
+			}
+			if playlists := library.MediaPlaylists(); !reflect.DeepEqual(playlists, snapshotPlaylists) {
+				t.Errorf("read playlists %+v, want %+v", playlists, snapshotPlaylists)
+			}
+		})
+	}
+	if err := Write(filepath.Join(dir, "library.txt"), NewLibrary(musicserviceclients.SERVICE_SPOTIFY, nil)); err == nil {
+		t.Error("Write() with an unsupported extension succeeded")
+	}
+}
+
+func TestSnapshotSchemaVersion(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  string
+		content string
+	}{
+		{"json newer version", FORMAT_JSON, `{"schemaVersion": 2, "playlists": []}`},
+		{"json missing version", FORMAT_JSON, `{"playlists": []}`},
+		{"yaml newer version", FORMAT_YAML, "schemaVersion: 2\nplaylists: []\n"},
+		{"yaml missing version", FORMAT_YAML, "playlists: []\n"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Decode([]byte(test.content), test.format)
+			if err == nil || !strings.Contains(err.Error(), "unsupported snapshot schema version") {
+				t.Errorf("Decode() err = %v, want unsupported snapshot schema version", err)
+			}
+		})
+	}
+}
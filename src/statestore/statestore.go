@@ -0,0 +1,160 @@
+package statestore
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"musicserviceclients"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const STATE_VERSION = 1
+
+type ServiceMapping struct {
+	Playlists map[string]string `json:"playlists"`
+	Tracks    map[string]string `json:"tracks"`
+	Skipped   map[string]bool   `json:"skipped,omitempty"`
+}
+
+type state struct {
+	Version  int                        `json:"version"`
+	Mappings map[string]*ServiceMapping `json:"mappings"`
+}
+
+// Store remembers which destination playlists and tracks source playlists and tracks were
+// migrated to. It is safe for concurrent use.
+type Store struct {
+	path  string
+	mu    sync.Mutex
+	state state
+}
+
+// Mapping is the view of a Store for one source and destination service pair.
+type Mapping struct {
+	store   *Store
+	mapping *ServiceMapping
+}
+
+func Open(path string) (*Store, error) {
+	store := &Store{path: path, state: state{Version: STATE_VERSION, Mappings: make(map[string]*ServiceMapping)}}
+	content, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state [path=%s][err=%v]", path, err)
+	}
+	err = json.Unmarshal(content, &store.state)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse state [path=%s][err=%v]", path, err)
+	}
+	if store.state.Version > STATE_VERSION {
+		return nil, fmt.Errorf("unsupported state version [path=%s][version=%d]", path, store.state.Version)
+	}
+	if store.state.Mappings == nil {
+		store.state.Mappings = make(map[string]*ServiceMapping)
+	}
+	return store, nil
+}
+
+// Save writes the store to a temporary file first so an interrupted run never truncates it.
+func (s *Store) Save() error {
+	s.mu.Lock()
+	content, err := json.MarshalIndent(s.state, "", "  ")
+	s.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to encode state [err=%v]", err)
+	}
+	temporary, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path)+".tmp")
+	if err != nil {
+		return fmt.Errorf("failed to write state [path=%s][err=%v]", s.path, err)
+	}
+	_, err = temporary.Write(content)
+	closeErr := temporary.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(temporary.Name(), s.path)
+	}
+	if err != nil {
+		os.Remove(temporary.Name())
+		return fmt.Errorf("failed to write state [path=%s][err=%v]", s.path, err)
+	}
+	return nil
+}
+
+func (s *Store) Mapping(sourceService, destinationService string) *Mapping {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := sourceService + ":" + destinationService
+	mapping, ok := s.state.Mappings[key]
+	if !ok {
+		mapping = &ServiceMapping{}
+		s.state.Mappings[key] = mapping
+	}
+	if mapping.Playlists == nil {
+		mapping.Playlists = make(map[string]string)
+	}
+	if mapping.Tracks == nil {
+		mapping.Tracks = make(map[string]string)
+	}
+	if mapping.Skipped == nil {
+		mapping.Skipped = make(map[string]bool)
+	}
+	return &Mapping{store: s, mapping: mapping}
+}
+
+func (m *Mapping) DestinationPlaylist(sourceId string) (string, bool) {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+	id, ok := m.mapping.Playlists[sourceId]
+	return id, ok && len(sourceId) > 0
+}
+
+func (m *Mapping) RecordPlaylist(sourceId, destinationId string) {
+	if len(sourceId) == 0 || len(destinationId) == 0 {
+		return
+	}
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+	m.mapping.Playlists[sourceId] = destinationId
+}
+
+func (m *Mapping) DestinationTrack(song musicserviceclients.Song) (string, bool) {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+	id, ok := m.mapping.Tracks[trackKey(song)]
+	return id, ok
+}
+
+func (m *Mapping) RecordTrack(song musicserviceclients.Song, destinationId string) {
+	if len(destinationId) == 0 {
+		return
+	}
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+	m.mapping.Tracks[trackKey(song)] = destinationId
+}
+
+// SkippedTrack reports whether song was skipped during an interactive review.
+func (m *Mapping) SkippedTrack(song musicserviceclients.Song) bool {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+	return m.mapping.Skipped[trackKey(song)]
+}
+
+func (m *Mapping) RecordSkip(song musicserviceclients.Song) {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+	m.mapping.Skipped[trackKey(song)] = true
+}
+
+func trackKey(song musicserviceclients.Song) string {
+	if len(song.Id) > 0 {
+		return song.Id
+	}
+	return musicserviceclients.SongKey(song)
+}